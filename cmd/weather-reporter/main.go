@@ -19,31 +19,131 @@ package main
 import (
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/jpxor/go-weather-reporter/internal"
+	"github.com/jpxor/go-weather-reporter/pkg/httphelper"
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
 )
 
 func main() {
+	// every logger writes through log.Writer(), so
+	// masking it here keeps secrets out of all logs
+	log.SetOutput(redact.Writer(log.Writer()))
+
 	logr := log.New(log.Writer(), "go-data-logger: ", log.LstdFlags|log.Lmsgprefix)
 	config, opts := parseArgs(logr)
+
+	if opts.PrintConfig {
+		err := internal.PrintConfig(os.Stdout, config)
+		if err != nil {
+			logr.Fatalln(err)
+		}
+		return
+	}
+	if opts.MetricsAddr != "" {
+		go serveMetrics(opts.MetricsAddr, logr)
+	}
 	internal.Run(config, opts, logr)
 }
 
+func serveMetrics(addr string, logr *log.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", httphelper.MetricsHandler())
+	logr.Println("serving metrics on", addr)
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		logr.Println("metrics server failed:", err)
+	}
+}
+
+const defaultConfigDir = "./config/"
+
+// stringList is a flag that may be repeated,
+// or given a comma separated list of values
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(val string) error {
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
 func parseArgs(logr *log.Logger) (internal.Config, internal.Opts) {
 	opts := internal.Opts{}
 
-	flag.StringVar(&opts.ConfigDir, "cdir", "./config/", "Set path to a directory containing config files")
+	flag.Var((*stringList)(&opts.ConfigDirs), "cdir", "Set path to a directory containing config files (repeatable, default ./config/)")
+	flag.Var((*stringList)(&opts.ConfigFiles), "config", "Set path to a config file (repeatable)")
+	flag.BoolVar(&opts.Recursive, "recursive", false, "Also load config files from subdirectories of each config directory")
+	flag.StringVar(&opts.CacheDir, "cache-dir", "", "Persist cached provider responses in this directory")
+	flag.StringVar(&opts.HTTPRecordDir, "http-record", "", "Record provider responses to cassette files in this directory")
+	flag.StringVar(&opts.HTTPReplayDir, "http-replay", "", "Replay provider responses from cassette files in this directory (offline)")
+	flag.StringVar(&opts.MetricsAddr, "metrics-addr", "", "Serve prometheus metrics at http://<addr>/metrics, ie. :9100")
 	flag.BoolVar(&opts.Once, "once", false, "Execute each query once, then exit")
+	flag.Var((*stringList)(&opts.Only), "only", "Run only the named services (comma separated)")
+	flag.Var((*stringList)(&opts.Except), "except", "Do not run the named services (comma separated)")
+	flag.Var((*stringList)(&opts.Labels), "labels", "Run only services with all of the given labels (comma separated key=value)")
+	flag.BoolVar(&opts.PrintConfig, "print-config", false, "Print the effective config, with secrets masked, then exit")
 	flag.Parse()
 
+	if len(opts.ConfigDirs) == 0 && len(opts.ConfigFiles) == 0 {
+		// the default config dir is optional when the
+		// service is configured from the environment
+		_, err := os.Stat(defaultConfigDir)
+		if err == nil || !internal.HasEnvConfig(os.Environ()) {
+			opts.ConfigDirs = []string{defaultConfigDir}
+		}
+	}
+
+	if opts.CacheDir != "" {
+		store, err := httphelper.NewDiskStore(opts.CacheDir)
+		if err != nil {
+			logr.Fatalln("failed to open cache dir:", err)
+		}
+		httphelper.DefaultCache = store
+
+		values, err := httphelper.NewValueCache(filepath.Join(opts.CacheDir, "values"))
+		if err != nil {
+			logr.Fatalln("failed to open cache dir:", err)
+		}
+		httphelper.DefaultValues = values
+	}
+
+	if opts.HTTPRecordDir != "" && opts.HTTPReplayDir != "" {
+		logr.Fatalln("-http-record and -http-replay can not be used together")
+	}
+	if opts.HTTPRecordDir != "" {
+		httphelper.SetRecordDir(opts.HTTPRecordDir)
+	}
+	if opts.HTTPReplayDir != "" {
+		httphelper.SetReplayDir(opts.HTTPReplayDir)
+	}
+
 	logr.Println("parsing config files")
 	parser := internal.NewConfigParser(logr)
-	config, err := parser.ParseConfigFiles(opts.ConfigDir)
+	parser.Recursive = opts.Recursive
+	config, err := parser.Parse(opts.ConfigDirs, opts.ConfigFiles)
 
 	if err != nil {
 		logr.Println(err)
 		logr.Fatalln("faild to parse config files")
 	}
+	internal.RegisterSecrets(config)
+
+	config, err = internal.SelectServices(config, opts, logr)
+	if err != nil {
+		logr.Fatalln(err)
+	}
 
 	return config, opts
 }
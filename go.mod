@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/influxdata/influxdb-client-go/v2 v2.9.1
 	github.com/jpxor/ssconfig v1.0.0
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 require (
@@ -12,5 +13,4 @@ require (
 	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	golang.org/x/net v0.0.0-20210119194325-5f4716e94777 // indirect
-	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
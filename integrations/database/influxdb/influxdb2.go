@@ -21,10 +21,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/jpxor/go-weather-reporter/integrations"
+	"github.com/jpxor/go-weather-reporter/pkg/httphelper"
 )
 
 var Name = "influxdb2"
@@ -75,7 +77,13 @@ func (r *Influxdb2Reporter) Init(fields []string, config map[string]interface{})
 	}
 	tags := convertToTags(tagsI)
 
-	r.client = influxdb2.NewClient(host, token)
+	httpClient, err := httphelper.NewClient(config, 20*time.Second)
+	if err != nil {
+		r.logr.Println(err)
+		return err
+	}
+
+	r.client = influxdb2.NewClientWithOptions(host, token, influxdb2.DefaultOptions().SetHTTPClient(httpClient))
 	r.org = org
 	r.bucket = bucket
 	r.measurement = measurement
@@ -86,6 +94,10 @@ func (r *Influxdb2Reporter) Init(fields []string, config map[string]interface{})
 	return nil
 }
 
+func (r *Influxdb2Reporter) SecretKeys() []string {
+	return []string{"token"}
+}
+
 func convertToTags(in map[interface{}]interface{}) map[string]string {
 	tags := make(map[string]string)
 	for k, v := range in {
@@ -105,12 +117,14 @@ func (r *Influxdb2Reporter) Close() {
 }
 
 func (r *Influxdb2Reporter) Report(data integrations.Data) error {
+	fields := filterDataFields(r.fields, data.Fields)
+	if len(fields) == 0 {
+		// nothing to write, a point must have fields
+		return nil
+	}
 	writer := r.client.WriteAPIBlocking(r.org, r.bucket)
 	point := influxdb2.NewPoint(
-		r.measurement, r.tags, filterDataFields(
-			r.fields,
-			data.Fields,
-		), data.Time,
+		r.measurement, mergeTags(r.tags, data.Tags), fields, data.Time,
 	)
 
 	// save points so that they can be resubmitted in case
@@ -128,10 +142,30 @@ func (r *Influxdb2Reporter) Report(data integrations.Data) error {
 	return err
 }
 
+// mergeTags adds the record tags to the configured tags,
+// configured tags take precedence
+func mergeTags(tags, dataTags map[string]string) map[string]string {
+	if len(dataTags) == 0 {
+		return tags
+	}
+	merged := make(map[string]string, len(tags)+len(dataTags))
+	for k, v := range dataTags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
 func filterDataFields(fkeys []string, dataFields map[string]integrations.Field) map[string]interface{} {
 	fields := make(map[string]interface{})
 	for _, field := range fkeys {
-		fields[field] = dataFields[field].Value
+		// records do not all have the same fields, ie.
+		// forecasts, and missing fields are left out
+		if f, ok := dataFields[field]; ok {
+			fields[field] = f.Value
+		}
 	}
 	return fields
 }
@@ -26,6 +26,10 @@ type Field struct {
 type Data struct {
 	Time   time.Time
 	Fields map[string]Field
+
+	// Tags identify the record when a query returns several,
+	// ie. the forecast type or location
+	Tags map[string]string
 }
 
 type SourceInterface interface {
@@ -33,7 +37,28 @@ type SourceInterface interface {
 	Query() (Data, error)
 }
 
+// MultiSourceInterface is optionally implemented by sources
+// that return several records per query, ie. forecasts
+type MultiSourceInterface interface {
+	SourceInterface
+	QueryAll() ([]Data, error)
+}
+
+// ThrottledSourceInterface is optionally implemented by sources
+// whose api says when new data may be requested, the service
+// doesn't query before then even if the poll_interval is shorter
+type ThrottledSourceInterface interface {
+	SourceInterface
+	NextQuery() time.Time
+}
+
 type DestinationInterface interface {
 	Init(fields []string, config map[string]interface{}) error
 	Report(Data) error
 }
+
+// SecretsInterface is optionally implemented by integrations
+// to mark config keys whose values must never be logged
+type SecretsInterface interface {
+	SecretKeys() []string
+}
@@ -0,0 +1,44 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package weather
+
+// normalized weather conditions, the value of the 'condition' field
+// of every source, so dashboards don't depend on the provider
+const (
+	ConditionClear        = "clear"
+	ConditionMostlyClear  = "mostly_clear"
+	ConditionPartlyCloudy = "partly_cloudy"
+	ConditionCloudy       = "cloudy"
+	ConditionFog          = "fog"
+	ConditionLightRain    = "light_rain"
+	ConditionRain         = "rain"
+	ConditionHeavyRain    = "heavy_rain"
+	ConditionLightSleet   = "light_sleet"
+	ConditionSleet        = "sleet"
+	ConditionHeavySleet   = "heavy_sleet"
+	ConditionLightSnow    = "light_snow"
+	ConditionSnow         = "snow"
+	ConditionHeavySnow    = "heavy_snow"
+	ConditionThunder      = "thunder"
+)
+
+// values of the 'daylight' field, for day and night icons
+const (
+	Day           = "day"
+	Night         = "night"
+	PolarTwilight = "polartwilight"
+)
@@ -23,6 +23,78 @@ const (
 	CloudCover    = "cloud_cover"
 	Precipitation = "precipitation"
 	WindSpeed     = "wind_speed"
+	Description   = "description"
+
+	FeelsLike                = "FeelsLike"
+	TemperatureMin           = "temperature_min"
+	TemperatureMax           = "temperature_max"
+	DewPoint                 = "dew_point"
+	UVIndex                  = "uv_index"
+	Visibility               = "visibility"
+	WindDirection            = "wind_direction"
+	WindGust                 = "wind_gust"
+	PrecipitationProbability = "precipitation_probability"
+	Rain                     = "rain"
+	Snow                     = "snow"
+	Summary                  = "summary"
+	Sunrise                  = "sunrise"
+	Sunset                   = "sunset"
+	Moonrise                 = "moonrise"
+	Moonset                  = "moonset"
+	MoonPhase                = "moon_phase"
+	SolarNoon                = "solar_noon"
+	SolarNoonElevation       = "solar_noon_elevation"
+	PressureSeaLevel         = "pressure_sea_level"
+	PressureGroundLevel      = "pressure_ground_level"
+	Rain1h                   = "rain_1h"
+	Rain3h                   = "rain_3h"
+	Snow1h                   = "snow_1h"
+	Snow3h                   = "snow_3h"
+
+	TemperaturePercentile10 = "temperature_percentile_10"
+	TemperaturePercentile90 = "temperature_percentile_90"
+	WindSpeedPercentile10   = "wind_speed_percentile_10"
+	WindSpeedPercentile90   = "wind_speed_percentile_90"
+	CloudCoverHigh          = "cloud_cover_high"
+	CloudCoverMedium        = "cloud_cover_medium"
+	CloudCoverLow           = "cloud_cover_low"
+	Fog                     = "fog"
+	PrecipitationMin        = "precipitation_min"
+	PrecipitationMax        = "precipitation_max"
+	ThunderProbability      = "thunder_probability"
+
+	PrecipitationRate = "precipitation_rate"
+	MinutesUntilRain  = "minutes_until_rain"
+
+	Condition           = "weather"
+	ConditionCode       = "condition_code"
+	ConditionIcon       = "condition_icon"
+	NormalizedCondition = "condition"
+	Daylight            = "daylight"
+
+	Latitude    = "latitude"
+	Longitude   = "longitude"
+	Timezone    = "timezone"
+	StationName = "station_name"
+	Country     = "country"
+	CityID      = "city_id"
+
+	AlertEvent       = "alert_event"
+	AlertSender      = "alert_sender"
+	AlertDescription = "alert_description"
+	AlertStart       = "alert_start"
+	AlertEnd         = "alert_end"
+	AlertTags        = "alert_tags"
+
+	AirQualityIndex = "aqi"
+	CarbonMonoxide  = "co"
+	NitrogenOxide   = "no"
+	NitrogenDioxide = "no2"
+	Ozone           = "o3"
+	SulphurDioxide  = "so2"
+	PM2_5           = "pm2_5"
+	PM10            = "pm10"
+	Ammonia         = "nh3"
 )
 
 const (
@@ -34,9 +106,10 @@ const (
 	Degrees = "degrees"
 	Radians = "radians"
 
-	Millimeters = "mm"
-	Centimeters = "cm"
-	Inches      = "in"
+	Millimeters        = "mm"
+	MillimetersPerHour = "mm/h"
+	Centimeters        = "cm"
+	Inches             = "in"
 
 	MetersPerSecond   = "m/s"
 	KilometersPerHour = "Kph"
@@ -46,5 +119,23 @@ const (
 	Bars        = "bar"
 	Atmospheres = "atm"
 
+	Meters = "m"
+	Index  = "index"
+
+	MicrogramsPerCubicMeter = "µg/m³"
+	AQI                     = "AQI"
+
+	// fraction of the cycle, ie. moon phase
+	Fraction = "fraction"
+
+	Seconds = "s"
+	Minutes = "min"
+
 	Text = "text"
+	Time = "Time"
 )
+
+// ForecastTag is the tag that distinguishes the records of a source
+// that reports more than the current conditions, ie. current,
+// minutely, hourly, daily or alert
+const ForecastTag = "forecast"
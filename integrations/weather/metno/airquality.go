@@ -0,0 +1,259 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Met Norway integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://api.met.no/weatherapi/airqualityforecast/0.1/documentation
+
+package metno
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+)
+
+var AirQualityName = "metno_air"
+
+// StationNearest selects the measuring station closest
+// to the configured coordinates
+const StationNearest = "nearest"
+
+// AirQualityService reports the air quality forecast of MET Norway,
+// it only covers Norway. The forecast is for the grid point nearest
+// the coordinates, or for a measuring station when one is configured
+type AirQualityService struct {
+	api
+	station  string
+	forecast bool
+}
+
+func (w *AirQualityService) Init(args map[string]interface{}) error {
+	err := w.api.init(args, "metno air source: ")
+	if err != nil {
+		return err
+	}
+
+	// the eoi code of a station, ie. NO0057A, or 'nearest'
+	switch station := args["station"].(type) {
+	case nil:
+	case string:
+		w.station = station
+	default:
+		w.logr.Println("'station' must be a station eoi code or:", StationNearest)
+		return fmt.Errorf("configuration has invalid field")
+	}
+
+	// the forecast is hourly, for the next 2 days
+	w.forecast, _ = args["forecast"].(bool)
+
+	w.logr.Println("Initialized!")
+	return nil
+}
+
+func (w *AirQualityService) Query() (integrations.Data, error) {
+	records, err := w.QueryAll()
+	if err != nil {
+		return integrations.Data{}, err
+	}
+	return records[0], nil
+}
+
+// QueryAll returns the air quality now, and the hourly
+// forecast when enabled
+func (w *AirQualityService) QueryAll() ([]integrations.Data, error) {
+	w.logr.Println("querying MET Norway air quality")
+
+	if w.station == StationNearest {
+		station, err := w.nearestStation()
+		if err != nil {
+			w.logr.Println("metno.nearestStation failed")
+			return nil, err
+		}
+		w.logr.Printf("using nearest station %s (%s)\n", station.EOI, station.Name)
+		w.station = station.EOI
+	}
+
+	forecast, err := w.airQualityForecast(w.client)
+	if err != nil {
+		w.logr.Println("metno.airQualityForecast failed")
+		return nil, err
+	}
+	steps := forecast.Data.Time
+	if len(steps) == 0 {
+		w.logr.Println("error: response is missing air quality data")
+		return nil, fmt.Errorf("metno air quality response is empty")
+	}
+
+	// the step covering now, the forecast may start in the past
+	now := time.Now()
+	current := 0
+	for i, step := range steps {
+		if !step.From.After(now) && now.Before(step.To) {
+			current = i
+			break
+		}
+	}
+	location := forecast.Meta.Location.Name
+
+	records := []integrations.Data{steps[current].record("current", location)}
+	if w.forecast {
+		for _, step := range steps[current+1:] {
+			records = append(records, step.record("hourly", location))
+		}
+	}
+	return records, nil
+}
+
+// airQualityVariables names the fields of the variables of the
+// forecast, MET reports AQI from 1 (low) to above 4 (very high)
+var airQualityVariables = map[string]string{
+	"AQI":                AirQualityIndex,
+	"pm25_concentration": PM2_5,
+	"pm10_concentration": PM10,
+	"no2_concentration":  NitrogenDioxide,
+	"o3_concentration":   Ozone,
+}
+
+func (s airQualityStep) record(forecast, location string) integrations.Data {
+	fields := map[string]integrations.Field{
+		StationName: {Value: location, Unit: Text},
+	}
+	for variable, name := range airQualityVariables {
+		v, ok := s.Variables[variable]
+		if !ok {
+			continue
+		}
+		unit := v.Units
+		switch {
+		case variable == "AQI":
+			unit = AQI
+		case unit == "ug/m3":
+			unit = MicrogramsPerCubicMeter
+		}
+		fields[name] = integrations.Field{Value: v.Value, Unit: unit}
+	}
+	return integrations.Data{
+		Time:   s.From,
+		Fields: fields,
+		Tags:   map[string]string{ForecastTag: forecast},
+	}
+}
+
+func (w *AirQualityService) airQualityForecast(client *http.Client) (*AirQualityResponse, error) {
+	q := url.Values{}
+	if w.station != "" {
+		q.Add("station", w.station)
+	} else {
+		q.Add("lat", fmt.Sprintf("%.4f", w.lat))
+		q.Add("lon", fmt.Sprintf("%.4f", w.lon))
+	}
+
+	result := AirQualityResponse{}
+	err := w.apiGet(client, "/airqualityforecast/0.1/", q, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// nearestStation returns the measuring station closest to the coordinates
+func (w *AirQualityService) nearestStation() (*AirQualityStation, error) {
+	var stations []AirQualityStation
+
+	err := w.apiGet(w.client, "/airqualityforecast/0.1/stations", url.Values{}, &stations)
+	if err != nil {
+		return nil, err
+	}
+	var nearest *AirQualityStation
+	var nearestDist float64
+	for i := range stations {
+		dist := distance(w.lat, w.lon, float64(stations[i].Latitude), float64(stations[i].Longitude))
+		if nearest == nil || dist < nearestDist {
+			nearest, nearestDist = &stations[i], dist
+		}
+	}
+	if nearest == nil {
+		return nil, fmt.Errorf("metno air quality has no stations")
+	}
+	return nearest, nil
+}
+
+// distance is the great circle distance between two coordinates, in km
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+	rad := math.Pi / 180
+
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+type AirQualityResponse struct {
+	Data struct {
+		Time []airQualityStep `json:"time"`
+	} `json:"data"`
+	Meta struct {
+		RefTime  time.Time `json:"reftime"`
+		Location struct {
+			Name      string     `json:"name"`
+			Path      string     `json:"path"`
+			Latitude  coordinate `json:"latitude"`
+			Longitude coordinate `json:"longitude"`
+		} `json:"location"`
+	} `json:"meta"`
+}
+
+type airQualityStep struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Variables map[string]struct {
+		Value float64 `json:"value"`
+		Units string  `json:"units"`
+	} `json:"variables"`
+}
+
+type AirQualityStation struct {
+	Name      string     `json:"name"`
+	EOI       string     `json:"eoi"`
+	Latitude  coordinate `json:"latitude"`
+	Longitude coordinate `json:"longitude"`
+}
+
+// coordinate is a latitude or longitude, which the air
+// quality api sends as either a number or a string
+type coordinate float64
+
+func (c *coordinate) UnmarshalJSON(b []byte) error {
+	str := strings.Trim(string(b), `"`)
+	if str == "" || str == "null" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return fmt.Errorf("invalid coordinate %s: %w", b, err)
+	}
+	*c = coordinate(f)
+	return nil
+}
@@ -0,0 +1,195 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Met Norway integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Met Norway terms of service: https://api.met.no/doc/TermsOfService
+
+package metno
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	. "github.com/jpxor/go-weather-reporter/pkg/httphelper"
+)
+
+// DefaultUserAgent identifies the application, the contact
+// of the config is added to it
+const DefaultUserAgent = "go-weather-reporter github.com/jpxor/go-weather-reporter"
+
+// api holds what every metno source shares: the location, the
+// User-Agent, and a client that is cached and rate limited per host
+type api struct {
+	client    *http.Client
+	logr      *log.Logger
+	limiter   *RateLimiter
+	baseURL   *url.URL
+	userAgent string
+	lat       float64
+	lon       float64
+	alt       int
+
+	// the latest Expires of a response, MET doesn't allow
+	// requesting the data again before then
+	expires time.Time
+}
+
+func (w *api) init(args map[string]interface{}, logPrefix string) error {
+	var ok bool
+	var err error
+
+	w.logr = log.New(log.Writer(), logPrefix, log.LstdFlags|log.Lmsgprefix)
+
+	// MET requires a User-Agent that identifies the application and
+	// how to reach its owner, or it may be blocked (403)
+	contact, ok := args["contact"].(string)
+	if !ok || contact == "" {
+		w.logr.Println("missing required 'contact', an email address or website for MET Norway to reach you")
+		w.logr.Println("  |>> see: https://api.met.no/doc/TermsOfService")
+		return fmt.Errorf("configuration missing required field")
+	}
+	userAgent, ok := args["user_agent"].(string)
+	if !ok {
+		userAgent = DefaultUserAgent
+	}
+	w.userAgent = userAgent + " " + contact
+
+	w.lat, ok = args["latitude"].(float64)
+	if !ok {
+		w.logr.Println("missing required 'latitude'")
+		return fmt.Errorf("configuration missing required field")
+	}
+
+	w.lon, ok = args["longitude"].(float64)
+	if !ok {
+		w.logr.Println("missing required 'longitude'")
+		return fmt.Errorf("configuration missing required field")
+	}
+
+	switch alt := args["altitude"].(type) {
+	case int:
+		w.alt = alt
+	case float64:
+		w.alt = int(alt)
+	default:
+		w.logr.Println("missing optional 'altitude', using default: 0")
+	}
+
+	// MetNo considers 20 requests/second to be heavy load,
+	// the limit applies to all users of api.met.no
+	w.baseURL, err = BaseURL(args, DefaultBaseURL)
+	if err != nil {
+		w.logr.Println(err)
+		return err
+	}
+
+	rates, err := SourceRates(args["rate_limit"], PerSecond(20))
+	if err != nil {
+		w.logr.Println(err)
+		return err
+	}
+	w.limiter = SharedRateLimiter(w.baseURL.Host, "", rates...)
+
+	// MET sets Expires on its responses, which is followed,
+	// the 10 minutes only apply to responses without it
+	w.client, err = NewSourceClient(args, 10*time.Second, w.limiter, 10*time.Minute, w.logr)
+	if err != nil {
+		w.logr.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// NextQuery is when the data of the last response expires,
+// MET's terms of service don't allow requesting it before then
+func (w *api) NextQuery() time.Time {
+	return w.expires
+}
+
+// apiGet sends a GET request for an api path and decodes
+// the json response into result
+func (w *api) apiGet(client *http.Client, path string, q url.Values, result interface{}) error {
+
+	url := Endpoint(w.baseURL, path)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		w.logr.Println("error: failed to create http request", err)
+		return err
+	}
+	req.URL.RawQuery = q.Encode()
+
+	req.Header.Add("Accept", "application/json")
+	req.Header.Set("User-Agent", w.userAgent)
+
+	res, err := client.Do(req)
+	if err != nil {
+		w.logr.Println("error: failed to send http request", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.Header.Get(CacheStatusHeader) {
+	case CacheHit:
+		w.logr.Println("info: metno using cached result (not yet expired)")
+	case CacheRevalidated:
+		w.logr.Println("info: metno using cached result (data not modified)")
+	case CacheMiss:
+		w.logr.Println("caching result | expires header:", res.Header.Get("Expires"))
+	}
+
+	err = CheckResponse(res)
+	if err != nil {
+		switch res.StatusCode {
+		case 429:
+			w.logr.Println("warning: throttling", url)
+		case 403:
+			w.logr.Println("error: access forbidden", url)
+			w.logr.Println("  |>> possible black-listed or missing User-Agent identifier")
+		}
+		w.logr.Println("error:", err)
+		return err
+	}
+
+	if deprecation := CheckDeprecation(res); deprecation != nil {
+		w.logr.Println("warning:", deprecation)
+		w.logr.Println("  |>> options: update, create pull request, or open an issue")
+		w.logr.Println("  |>> see: https://github.com/jpxor/go-weather-reporter/issues")
+	}
+
+	if expires, err := http.ParseTime(res.Header.Get("Expires")); err == nil && expires.After(w.expires) {
+		w.expires = expires
+	}
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		w.logr.Println("error: failed to read response from", url)
+		return err
+	}
+
+	err = json.Unmarshal(buf, result)
+	if err != nil {
+		w.logr.Println("error: failed to parse response from", url)
+		w.logr.Println(err)
+		return err
+	}
+	return nil
+}
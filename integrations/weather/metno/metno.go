@@ -21,259 +21,214 @@
 package metno
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"time"
 
+	"github.com/jpxor/go-weather-reporter/integrations"
 	. "github.com/jpxor/go-weather-reporter/integrations/weather"
-	. "github.com/jpxor/go-weather-reporter/pkg/httphelper"
 )
 
-type CachedResult struct {
-	Result       *MetNoResponse
-	Expires      time.Time
-	LastModified time.Time
-}
+// DefaultBaseURL is used unless the config sets base_url
+const DefaultBaseURL = "https://api.met.no/weatherapi"
 
-type MetNoService struct {
-	client          *http.Client
-	logr            *log.Logger
-	cache           map[string]CachedResult
-	previousRequest time.Time
-}
+var Name = "metno"
 
-func NewWeatherService(logr *log.Logger) *MetNoService {
-	client := SimpleClient(10 * time.Second)
-	return &MetNoService{
-		client:          client,
-		logr:            logr,
-		cache:           make(map[string]CachedResult),
-		previousRequest: time.Unix(0, 0),
-	}
+// the compact variant has the most used variables, complete
+// adds percentiles, fog, dew point, UV index and more
+const (
+	VariantCompact  = "compact"
+	VariantComplete = "complete"
+)
+
+type MetNoService struct {
+	api
+	variant string
+	lang    string
 }
 
-func (w *MetNoService) Query(loc Location) (*Weather, error) {
-	w.logr.Println("querying MET Norway")
+func (w *MetNoService) Init(args map[string]interface{}) error {
+	var ok bool
 
-	forcast, err := w.locationForecast(w.client, loc.Latitude, loc.Longitude, int(loc.Altitude))
+	err := w.api.init(args, "metno source: ")
 	if err != nil {
-		w.logr.Println("metno.LocationForcast failed")
-		return nil, err
+		return err
 	}
-	instants := forcast.Properties.Timeseries[0].Data.Instant.Details
-	data := forcast.Properties.Timeseries[0].Data
 
-	ret := Weather{
-		Time: forcast.Properties.Timeseries[0].Time,
-		Location: Location{
-			Latitude:  forcast.Geometry.Coordinates[0],
-			Longitude: forcast.Geometry.Coordinates[1],
-			Altitude:  forcast.Geometry.Coordinates[2],
-		},
-		Measurements: []Measurement{
-			{
-				Name:  Temperature,
-				Value: instants.AirTemperature,
-				Unit:  Celcius,
-			}, {
-				Name:  RelHumidity,
-				Value: instants.RelHumidity,
-				Unit:  Percent,
-			}, {
-				Name:  Pressure,
-				Value: instants.AirPressure,
-				Unit:  HectoPascal,
-			}, {
-				Name:  Precipitation,
-				Value: data.Next1Hours.Details.Precipitation,
-				Unit:  Millimeters,
-			}, {
-				Name:  WindSpeed,
-				Value: instants.WindSpeed,
-				Unit:  MetersPerSecond,
-			}, {
-				Name:  CloudCover,
-				Value: instants.CloudArea,
-				Unit:  Percent,
-			}, {
-				Name:  "wind_direction",
-				Value: instants.WindFromDirection,
-				Unit:  Degrees,
-			},
-		},
+	w.variant, ok = args["variant"].(string)
+	if !ok {
+		w.variant = VariantCompact
 	}
-	return &ret, nil
-}
-
-func (w *MetNoService) locationForecast(client *http.Client, lat, lon float64, alt int) (*MetNoResponse, error) {
-
-	// MetNo service expects client side caching
-	cacheHit, lastModified := w.cachedResult(lat, lon, alt)
-	if cacheHit != nil {
-		w.logr.Println("info: metno using cached result (not yet expired)")
-		return cacheHit, nil
+	if w.variant != VariantCompact && w.variant != VariantComplete {
+		w.logr.Println("unknown 'variant':", w.variant, "expected one of:", VariantCompact, VariantComplete)
+		return fmt.Errorf("configuration has invalid field")
 	}
 
-	// MetNo considers 20 requests/second to be heavy load,
-	// we self-throttle by enforcing at least 50ms interval
-	// between requests
-	w.selfThrottle()
-
-	url := "https://api.met.no/weatherapi/locationforecast/2.0/compact"
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		w.logr.Println("error: failed to create http request", err)
-		return nil, err
+	// the summary of the weather symbol is in english
+	// or norwegian bokmål
+	w.lang, ok = args["language"].(string)
+	if !ok {
+		w.logr.Println("missing optional 'language', using default: 'en'")
+		w.lang = "en"
+	}
+	if w.lang == "no" {
+		w.lang = "nb"
+	}
+	if _, ok := summaryLanguages[w.lang]; !ok {
+		w.logr.Println("unsupported 'language':", w.lang, "expected one of: en, nb")
+		return fmt.Errorf("configuration has invalid field")
 	}
 
-	q := req.URL.Query()
-	q.Add("lat", fmt.Sprintf("%.4f", lat))
-	q.Add("lon", fmt.Sprintf("%.4f", lon))
-	q.Add("altitude", fmt.Sprintf("%d", alt))
-	req.URL.RawQuery = q.Encode()
+	w.logr.Println("Initialized!")
+	return nil
+}
 
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("If-Modified-Since", lastModified.Format(time.RFC1123))
-	req.Header.Set("User-Agent", "go-weather-reporter client (https://github.com/jpxor/go-weather-reporter)")
+func (w *MetNoService) Query() (integrations.Data, error) {
+	w.logr.Println("querying MET Norway")
 
-	res, err := client.Do(req)
+	forcast, err := w.locationForecast(w.client, w.lat, w.lon, w.alt)
 	if err != nil {
-		w.logr.Println("error: failed to send http request", err)
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	// request sent, so track the time for self throttling
-	w.previousRequest = time.Now()
-
-	if ServerErrorStatus(res.StatusCode) {
-		w.logr.Println("warning: server error", url)
-		return nil, ServerErrorRetry
+		w.logr.Println("metno.LocationForcast failed")
+		return integrations.Data{}, err
 	}
-
-	if ClientErrorStatus(res.StatusCode) {
-		if res.StatusCode == 429 {
-			w.logr.Println("warning: throttling", url)
-			return nil, ClientErrorRetry
-		}
-		if res.StatusCode == 403 {
-			w.logr.Println("error: access forbidden", url)
-			w.logr.Println("  |>> possible black-listed or missing User-Agent identifier")
-			return nil, ClientErrorFatal
-		}
-		if res.StatusCode == 400 {
-			w.logr.Println("error: Bad Request", req.URL.String())
-
-			buf, err := ioutil.ReadAll(res.Body)
-			if err != nil {
-				w.logr.Println("error: failed to read response body")
-				return nil, err
-			}
-			w.logr.Println(string(buf))
-			return nil, ClientErrorFatal
-		}
-		w.logr.Println("error: http client error", res.StatusCode, url)
-		return nil, ClientErrorRetry
+	step, err := stepAt(forcast.Properties.Timeseries, time.Now())
+	if err != nil {
+		w.logr.Println("error:", err)
+		return integrations.Data{}, err
 	}
 
-	if RedirectStatus(res.StatusCode) {
-		if res.StatusCode != 304 {
-			w.logr.Println("warning: unhandled http status", res.StatusCode, url)
-		}
-		// data not modified since last response,
-		// means cache is still valid even if expired
-		cachehit, _ := w.cachedResult(lat, lon, alt)
-		if cachehit != nil {
-			w.logr.Println("info: metno using cached result (data not modified)")
+	fields := step.fields(forcast.Properties.Meta.Units)
+	step.addConditions(fields, w.lang)
 
-			// check for new expires
-			expiresHdr := res.Header.Get("Expires")
-			w.logr.Println("value not changed | new expires header:", expiresHdr)
+	return integrations.Data{
+		Time:   step.Time,
+		Fields: fields,
+	}, nil
+}
 
-			// reuse existing last-modified time
-			lastModHdr := lastModified.Format(time.RFC1123)
+// circularVariables are angles, interpolated the short
+// way around the circle
+var circularVariables = map[string]bool{
+	"wind_from_direction": true,
+}
 
-			w.setCachedResult(lat, lon, alt, expiresHdr, lastModHdr, cachehit)
-			return cachehit, nil
-		}
+// stepAt returns the timestep for time t, with the instant values
+// interpolated between the entries before and after it. Times outside
+// the timeseries use the first or last entry
+func stepAt(timeseries []MetNoTimestep, t time.Time) (MetNoTimestep, error) {
+	if len(timeseries) == 0 {
+		return MetNoTimestep{}, fmt.Errorf("metno response has an empty timeseries")
 	}
-
-	if SuccessStatus(res.StatusCode) {
-		if res.StatusCode == 203 {
-			w.logr.Println("warning: depreciated service or api:", url)
-			w.logr.Println("  |>> options: update, create pull request, or open an issue")
-			w.logr.Println("  |>> see: https://github.com/jpxor/go-weather-reporter/issues")
+	if !t.After(timeseries[0].Time) {
+		return timeseries[0], nil
+	}
+	for i := 1; i < len(timeseries); i++ {
+		before, after := timeseries[i-1], timeseries[i]
+		if after.Time.Before(t) {
+			continue
 		}
-
-		buf, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			w.logr.Println("error: failed to read response from", url)
-			return nil, err
+		if after.Time.Equal(t) {
+			return after, nil
 		}
-
-		result := MetNoResponse{}
-		err = json.Unmarshal(buf, &result)
-		if err != nil {
-			w.logr.Println("error: failed to parse response from", url)
-			w.logr.Println(err)
-			return nil, err
+		frac := float64(t.Sub(before.Time)) / float64(after.Time.Sub(before.Time))
+
+		// the periods (next hour, next 6 hours) starting before t cover it
+		step := before
+		step.Time = t
+		step.Data.Instant.Details = make(map[string]float64, len(before.Data.Instant.Details))
+		for variable, a := range before.Data.Instant.Details {
+			b, ok := after.Data.Instant.Details[variable]
+			switch {
+			case !ok:
+				step.Data.Instant.Details[variable] = a
+			case circularVariables[variable]:
+				diff := math.Mod(b-a+540, 360) - 180
+				step.Data.Instant.Details[variable] = math.Mod(a+frac*diff+360, 360)
+			default:
+				step.Data.Instant.Details[variable] = a + frac*(b-a)
+			}
 		}
-
-		// cache result
-		expiresHdr := res.Header.Get("Expires")
-		lastModHdr := res.Header.Get("Last-Modified")
-		w.logr.Println("caching result | expires header:", expiresHdr)
-		w.setCachedResult(lat, lon, alt, expiresHdr, lastModHdr, &result)
-
-		return &result, nil
+		return step, nil
 	}
+	return timeseries[len(timeseries)-1], nil
+}
 
-	return nil, fmt.Errorf("metno unknown error")
+// instantFields names the fields of the instant variables,
+// variables not listed here keep the name MET gives them
+var instantFields = map[string]string{
+	"air_pressure_at_sea_level":     Pressure,
+	"air_temperature":               Temperature,
+	"air_temperature_percentile_10": TemperaturePercentile10,
+	"air_temperature_percentile_90": TemperaturePercentile90,
+	"cloud_area_fraction":           CloudCover,
+	"cloud_area_fraction_high":      CloudCoverHigh,
+	"cloud_area_fraction_medium":    CloudCoverMedium,
+	"cloud_area_fraction_low":       CloudCoverLow,
+	"dew_point_temperature":         DewPoint,
+	"fog_area_fraction":             Fog,
+	"relative_humidity":             RelHumidity,
+	"ultraviolet_index_clear_sky":   UVIndex,
+	"wind_from_direction":           WindDirection,
+	"wind_speed":                    WindSpeed,
+	"wind_speed_of_gust":            WindGust,
+	"wind_speed_percentile_10":      WindSpeedPercentile10,
+	"wind_speed_percentile_90":      WindSpeedPercentile90,
 }
 
-func cacheKey(lat, lon float64, alt int) string {
-	// lat and long uses a single decimal point of precision
-	// alt is meters above sea level and uses 20m resolution
-	return fmt.Sprintf("%d-%d-%d", int(lat*10), int(lon*10), alt/20)
+// next1HoursFields names the fields of the variables
+// for the next hour
+var next1HoursFields = map[string]string{
+	"precipitation_amount":         Precipitation,
+	"precipitation_amount_min":     PrecipitationMin,
+	"precipitation_amount_max":     PrecipitationMax,
+	"probability_of_precipitation": PrecipitationProbability,
+	"probability_of_thunder":       ThunderProbability,
 }
 
-func (w *MetNoService) cachedResult(lat, lon float64, alt int) (*MetNoResponse, time.Time) {
-	cachehit := w.cache[cacheKey(lat, lon, alt)]
-	if cachehit.Expires.After(time.Now()) {
-		return cachehit.Result, cachehit.LastModified
-	}
-	return nil, cachehit.LastModified
+// next6HoursFields names the only variables taken from the
+// next 6 hours, the others overlap the next hour
+var next6HoursFields = map[string]string{
+	"air_temperature_min": TemperatureMin,
+	"air_temperature_max": TemperatureMax,
 }
 
-func (w *MetNoService) setCachedResult(lat, lon float64, alt int, expiresHdr, lastModHdr string, result *MetNoResponse) {
-	var cacheEntry CachedResult
-	expires, err := time.Parse(time.RFC1123, expiresHdr)
-	if err != nil {
-		w.logr.Println("warning: failed to parse http header date")
-	} else {
-		cacheEntry = CachedResult{
-			Expires: expires,
-			Result:  result,
-		}
-	}
-	if cacheEntry.Result == nil {
-		// set our own expires if the above failed
-		cacheEntry = CachedResult{
-			Expires: time.Now().Add(10 * time.Minute),
-			Result:  result,
+// fields maps every variable of the timestep to a field, with
+// the unit MET reports for it
+func (s *MetNoTimestep) fields(units map[string]string) map[string]integrations.Field {
+	fields := make(map[string]integrations.Field)
+
+	add := func(details map[string]float64, names map[string]string, all bool) {
+		for variable, value := range details {
+			name, ok := names[variable]
+			if !ok {
+				if !all {
+					continue
+				}
+				name = variable
+			}
+			fields[name] = integrations.Field{Value: value, Unit: units[variable]}
 		}
 	}
-	w.cache[cacheKey(lat, lon, alt)] = cacheEntry
+	add(s.Data.Instant.Details, instantFields, true)
+	add(s.Data.Next1Hours.Details, next1HoursFields, true)
+	add(s.Data.Next6Hours.Details, next6HoursFields, false)
+	return fields
 }
 
-func (w *MetNoService) selfThrottle() {
-	sinceLastReq := time.Now().Sub(w.previousRequest)
-	if sinceLastReq < 50*time.Millisecond {
-		time.Sleep(50*time.Millisecond - sinceLastReq)
+func (w *MetNoService) locationForecast(client *http.Client, lat, lon float64, alt int) (*MetNoResponse, error) {
+	q := url.Values{}
+	q.Add("lat", fmt.Sprintf("%.4f", lat))
+	q.Add("lon", fmt.Sprintf("%.4f", lon))
+	q.Add("altitude", fmt.Sprintf("%d", alt))
+
+	result := MetNoResponse{}
+	err := w.apiGet(client, "/locationforecast/2.0/"+w.variant, q, &result)
+	if err != nil {
+		return nil, err
 	}
+	return &result, nil
 }
 
 type MetNoResponse struct {
@@ -285,54 +240,31 @@ type MetNoResponse struct {
 	Properties struct {
 		Meta struct {
 			UpdatedAt time.Time `json:"updated_at"`
-			Units     struct {
-				AirPressure       string `json:"air_pressure_at_sea_level"`
-				AirTemperature    string `json:"air_temperature"`
-				CloudArea         string `json:"cloud_area_fraction"`
-				Precipitation     string `json:"precipitation_amount"`
-				RelHumidity       string `json:"relative_humidity"`
-				WindFromDirection string `json:"wind_from_direction"`
-				WindSpeed         string `json:"wind_speed"`
-			} `json:"units"`
+			// unit of each variable, by variable name
+			Units map[string]string `json:"units"`
 		} `json:"meta"`
-		Timeseries []struct {
-			Time time.Time `json:"time"`
-			Data struct {
-				Instant struct {
-					Details struct {
-						AirPressure       float32 `json:"air_pressure_at_sea_level"`
-						AirTemperature    float32 `json:"air_temperature"`
-						CloudArea         float32 `json:"cloud_area_fraction"`
-						RelHumidity       float32 `json:"relative_humidity"`
-						WindFromDirection float32 `json:"wind_from_direction"`
-						WindSpeed         float32 `json:"wind_speed"`
-					} `json:"details"`
-				} `json:"instant"`
-				Next1Hours struct {
-					Summary struct {
-						SymbolCode string `json:"symbol_code"`
-					} `json:"summary"`
-					Details struct {
-						Precipitation float32 `json:"precipitation_amount"`
-					} `json:"details"`
-				} `json:"next_1_hours"`
-				Next6Hours struct {
-					Summary struct {
-						SymbolCode string `json:"symbol_code"`
-					} `json:"summary"`
-					Details struct {
-						Precipitation float32 `json:"precipitation_amount"`
-					} `json:"details"`
-				} `json:"next_6_hours"`
-				Next12Hours struct {
-					Summary struct {
-						SymbolCode string `json:"symbol_code"`
-					} `json:"summary"`
-					Details struct {
-						Precipitation float32 `json:"precipitation_amount"`
-					} `json:"details"`
-				} `json:"next_12_hours"`
-			} `json:"data"`
-		} `json:"timeseries"`
+		Timeseries []MetNoTimestep `json:"timeseries"`
 	} `json:"properties"`
 }
+
+// MetNoTimestep is one time of the forecast, details hold
+// the value of each variable by name
+type MetNoTimestep struct {
+	Time time.Time `json:"time"`
+	Data struct {
+		Instant struct {
+			Details map[string]float64 `json:"details"`
+		} `json:"instant"`
+		Next1Hours  MetNoPeriod `json:"next_1_hours"`
+		Next6Hours  MetNoPeriod `json:"next_6_hours"`
+		Next12Hours MetNoPeriod `json:"next_12_hours"`
+	} `json:"data"`
+}
+
+// MetNoPeriod is the forecast for a period following a timestep
+type MetNoPeriod struct {
+	Summary struct {
+		SymbolCode string `json:"symbol_code"`
+	} `json:"summary"`
+	Details map[string]float64 `json:"details"`
+}
@@ -0,0 +1,163 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Met Norway integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package metno
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+	"github.com/jpxor/go-weather-reporter/pkg/httphelper"
+)
+
+// the cassettes are replayed, so no request reaches api.met.no
+func TestQueryReplay(t *testing.T) {
+	httphelper.SetReplayDir("testdata/cassettes")
+	defer httphelper.SetReplayDir("")
+
+	w := &MetNoService{}
+	err := w.Init(map[string]interface{}{
+		"latitude":  59.91,
+		"longitude": 10.75,
+		"contact":   "test@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := w.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the recorded forecast is in the past, so the last step is used
+	if want := time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC); !data.Time.Equal(want) {
+		t.Errorf("time: got %v, want %v", data.Time, want)
+	}
+	for name, want := range map[string]interface{}{
+		Temperature:         -3.8,
+		WindDirection:       10.0,
+		Precipitation:       0.8,
+		TemperatureMin:      -5.0,
+		NormalizedCondition: ConditionSnow,
+		Summary:             "Snow",
+		Summary + "_6h":     "Heavy snow",
+	} {
+		if got := data.Fields[name].Value; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	if got := data.Fields[Temperature].Unit; got != Celcius {
+		t.Errorf("temperature unit: got %s, want %s", got, Celcius)
+	}
+}
+
+func timestep(t time.Time, temperature, direction float64) MetNoTimestep {
+	var step MetNoTimestep
+	step.Time = t
+	step.Data.Instant.Details = map[string]float64{
+		"air_temperature":     temperature,
+		"wind_from_direction": direction,
+	}
+	return step
+}
+
+func TestStepAt(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeseries := []MetNoTimestep{
+		timestep(start, 0, 350),
+		timestep(start.Add(time.Hour), 4, 10),
+	}
+
+	tests := []struct {
+		name            string
+		at              time.Time
+		wantTime        time.Time
+		wantTemperature float64
+		wantDirection   float64
+	}{
+		{"before first", start.Add(-time.Hour), start, 0, 350},
+		{"on first", start, start, 0, 350},
+		{"wraps past north", start.Add(45 * time.Minute), start.Add(45 * time.Minute), 3, 5},
+		{"before north", start.Add(15 * time.Minute), start.Add(15 * time.Minute), 1, 355},
+		{"on last", start.Add(time.Hour), start.Add(time.Hour), 4, 10},
+		{"after last", start.Add(3 * time.Hour), start.Add(time.Hour), 4, 10},
+	}
+	for _, test := range tests {
+		step, err := stepAt(timeseries, test.at)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !step.Time.Equal(test.wantTime) {
+			t.Errorf("%s: time: got %v, want %v", test.name, step.Time, test.wantTime)
+		}
+		details := step.Data.Instant.Details
+		if got := details["air_temperature"]; math.Abs(got-test.wantTemperature) > 1e-9 {
+			t.Errorf("%s: temperature: got %v, want %v", test.name, got, test.wantTemperature)
+		}
+		if got := details["wind_from_direction"]; math.Abs(got-test.wantDirection) > 1e-9 {
+			t.Errorf("%s: wind direction: got %v, want %v", test.name, got, test.wantDirection)
+		}
+	}
+
+	// interpolating must not change the forecast
+	if got := timeseries[0].Data.Instant.Details["wind_from_direction"]; got != 350 {
+		t.Errorf("stepAt modified the timeseries: wind direction %v", got)
+	}
+}
+
+func TestStepAtEmpty(t *testing.T) {
+	_, err := stepAt(nil, time.Now())
+	if err == nil {
+		t.Error("empty timeseries: expected an error")
+	}
+}
+
+func TestSunriseDateCrossesMidnight(t *testing.T) {
+	// 23:30 UTC is already the next day east of Greenwich,
+	// and still the same day west of it
+	now := time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		lon        float64
+		wantDate   string
+		wantOffset string
+	}{
+		{lon: 151.21, wantDate: "2026-10-19", wantOffset: "+10:00"},
+		{lon: 10.75, wantDate: "2026-10-19", wantOffset: "+01:00"},
+		{lon: -0.13, wantDate: "2026-10-18", wantOffset: "+00:00"},
+		{lon: -122.42, wantDate: "2026-10-18", wantOffset: "-08:00"},
+	}
+	for _, tt := range tests {
+		date := localDate(now, solarZone(tt.lon))
+		if got := date.Format("2006-01-02"); got != tt.wantDate {
+			t.Errorf("lon %v: got date %v, want %v", tt.lon, got, tt.wantDate)
+		}
+		if got := date.Format("-07:00"); got != tt.wantOffset {
+			t.Errorf("lon %v: got offset %v, want %v", tt.lon, got, tt.wantOffset)
+		}
+	}
+
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skip(err)
+	}
+	summer := localDate(time.Date(2026, 7, 1, 22, 30, 0, 0, time.UTC), oslo)
+	if got := summer.Format("2006-01-02 -07:00"); got != "2026-07-02 +02:00" {
+		t.Errorf("Europe/Oslo: got %v, want 2026-07-02 +02:00", got)
+	}
+}
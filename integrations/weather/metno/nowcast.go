@@ -0,0 +1,154 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Met Norway integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://api.met.no/weatherapi/nowcast/2.0/documentation
+
+package metno
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+)
+
+var NowcastName = "metno_nowcast"
+
+// NowcastService reports radar based precipitation for the next two
+// hours at 5 minute resolution. MET only has radar coverage of the
+// Nordic countries
+type NowcastService struct {
+	api
+}
+
+func (w *NowcastService) Init(args map[string]interface{}) error {
+	err := w.api.init(args, "metno nowcast source: ")
+	if err != nil {
+		return err
+	}
+
+	w.logr.Println("Initialized!")
+	return nil
+}
+
+// Query returns the current conditions, with the minutes until rain
+func (w *NowcastService) Query() (integrations.Data, error) {
+	records, err := w.QueryAll()
+	if err != nil {
+		return integrations.Data{}, err
+	}
+	return records[0], nil
+}
+
+// QueryAll returns the current conditions, and a record with
+// the precipitation rate for every 5 minutes of the nowcast
+func (w *NowcastService) QueryAll() ([]integrations.Data, error) {
+	w.logr.Println("querying MET Norway nowcast")
+
+	nowcast, err := w.nowcast(w.client, w.lat, w.lon)
+	if err != nil {
+		w.logr.Println("metno.nowcast failed")
+		return nil, err
+	}
+	props := nowcast.Properties
+	if coverage := props.Meta.RadarCoverage; coverage != "ok" {
+		w.logr.Println("error: no radar coverage of the location:", coverage)
+		return nil, fmt.Errorf("metno nowcast radar coverage: %s", coverage)
+	}
+	if len(props.Timeseries) == 0 {
+		w.logr.Println("error: response is missing timeseries")
+		return nil, fmt.Errorf("metno nowcast response is empty")
+	}
+
+	current := props.Timeseries[0]
+	fields := current.fields(props.Meta.Units)
+	fields[MinutesUntilRain] = integrations.Field{
+		Value: minutesUntilRain(props.Timeseries, time.Now()),
+		Unit:  Minutes,
+	}
+	records := []integrations.Data{{
+		Time:   current.Time,
+		Fields: fields,
+		Tags:   map[string]string{ForecastTag: "current"},
+	}}
+
+	for _, step := range props.Timeseries {
+		rate, ok := step.Data.Instant.Details["precipitation_rate"]
+		if !ok {
+			continue
+		}
+		records = append(records, integrations.Data{
+			Time: step.Time,
+			Fields: map[string]integrations.Field{
+				PrecipitationRate: {Value: rate, Unit: props.Meta.Units["precipitation_rate"]},
+			},
+			Tags: map[string]string{ForecastTag: "minutely"},
+		})
+	}
+	return records, nil
+}
+
+// minutesUntilRain is the time from now until the first step with
+// precipitation, 0 when it is raining now, and -1 when no rain is
+// expected within the nowcast
+func minutesUntilRain(timeseries []MetNoTimestep, now time.Time) int {
+	for _, step := range timeseries {
+		if step.Data.Instant.Details["precipitation_rate"] <= 0 {
+			continue
+		}
+		minutes := int(step.Time.Sub(now).Minutes())
+		if minutes < 0 {
+			return 0
+		}
+		return minutes
+	}
+	return -1
+}
+
+func (w *NowcastService) nowcast(client *http.Client, lat, lon float64) (*NowcastResponse, error) {
+	q := url.Values{}
+	q.Add("lat", fmt.Sprintf("%.4f", lat))
+	q.Add("lon", fmt.Sprintf("%.4f", lon))
+
+	result := NowcastResponse{}
+	err := w.apiGet(client, "/nowcast/2.0/complete", q, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type NowcastResponse struct {
+	Type     string `json:"type"`
+	Geometry struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		Meta struct {
+			UpdatedAt time.Time `json:"updated_at"`
+			// unit of each variable, by variable name
+			Units map[string]string `json:"units"`
+			// ok, temporarily unavailable or no coverage
+			RadarCoverage string `json:"radar_coverage"`
+		} `json:"meta"`
+		Timeseries []MetNoTimestep `json:"timeseries"`
+	} `json:"properties"`
+}
@@ -0,0 +1,215 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Met Norway integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://api.met.no/weatherapi/sunrise/3.0/documentation
+
+package metno
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+	. "github.com/jpxor/go-weather-reporter/pkg/httphelper"
+)
+
+var SunriseName = "metno_sunrise"
+
+// SunriseService reports the sun and moon times of the day for
+// the location. They only change once a day, so the result is
+// kept until midnight (on disk when -cache-dir is set)
+type SunriseService struct {
+	api
+	// the timezone of the location, the day and times are in it
+	zone *time.Location
+}
+
+func (w *SunriseService) Init(args map[string]interface{}) error {
+	err := w.api.init(args, "metno sunrise source: ")
+	if err != nil {
+		return err
+	}
+
+	name, ok := args["timezone"].(string)
+	if ok {
+		w.zone, err = time.LoadLocation(name)
+		if err != nil {
+			w.logr.Println(err)
+			return err
+		}
+	} else {
+		w.zone = solarZone(w.lon)
+		w.logr.Println("missing optional 'timezone', using the offset of the longitude:", w.zone)
+	}
+
+	w.logr.Println("Initialized!")
+	return nil
+}
+
+func (w *SunriseService) Query() (integrations.Data, error) {
+	w.logr.Println("querying MET Norway sunrise")
+
+	date := localDate(time.Now(), w.zone)
+
+	day, err := w.sunriseDay(date)
+	if err != nil {
+		w.logr.Println("metno.sunriseDay failed")
+		return integrations.Data{}, err
+	}
+
+	fields := make(map[string]integrations.Field)
+	addTime := func(name string, event *sunriseEvent) {
+		// there is no sunrise or moonset on some days, ie. polar night
+		if event != nil && !event.Time.IsZero() {
+			fields[name] = integrations.Field{Value: event.Time.Time, Unit: Time}
+		}
+	}
+	addTime(Sunrise, day.Sun.Properties.Sunrise)
+	addTime(Sunset, day.Sun.Properties.Sunset)
+	addTime(SolarNoon, day.Sun.Properties.SolarNoon)
+	addTime(Moonrise, day.Moon.Properties.Moonrise)
+	addTime(Moonset, day.Moon.Properties.Moonset)
+
+	if noon := day.Sun.Properties.SolarNoon; noon != nil {
+		fields[SolarNoonElevation] = integrations.Field{Value: noon.Elevation, Unit: Degrees}
+	}
+	// MET gives the phase in degrees, 0 is new moon and 180 is
+	// full moon, it is reported as a fraction of the cycle
+	fields[MoonPhase] = integrations.Field{Value: day.Moon.Properties.MoonPhase / 360, Unit: Fraction}
+
+	return integrations.Data{
+		Time:   date,
+		Fields: fields,
+	}, nil
+}
+
+// solarZone is the zone of the whole hour offset nearest to the
+// solar time at longitude lon, it ignores daylight saving time
+func solarZone(lon float64) *time.Location {
+	hours := int(math.Round(lon / 15))
+	return time.FixedZone(fmt.Sprintf("UTC%+03d:00", hours), hours*3600)
+}
+
+// localDate is midnight of the day of now in zone
+func localDate(now time.Time, zone *time.Location) time.Time {
+	now = now.In(zone)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, zone)
+}
+
+// sunriseDay holds the sun and moon responses for one date
+type sunriseDay struct {
+	Sun  SunriseResponse `json:"sun"`
+	Moon SunriseResponse `json:"moon"`
+}
+
+// sunriseDay returns the sun and moon of the date, from the value
+// cache when they were already fetched today
+func (w *SunriseService) sunriseDay(date time.Time) (*sunriseDay, error) {
+	var day sunriseDay
+
+	cacheKey := fmt.Sprintf("metno-sunrise:%.4f,%.4f,%s", w.lat, w.lon, date.Format("2006-01-02"))
+	if DefaultValues.Get(cacheKey, &day) {
+		w.logr.Println("info: metno using cached result (not yet expired)")
+		return &day, nil
+	}
+
+	err := w.sunrise(w.client, "/sunrise/3.0/sun", date, &day.Sun)
+	if err != nil {
+		return nil, err
+	}
+	err = w.sunrise(w.client, "/sunrise/3.0/moon", date, &day.Moon)
+	if err != nil {
+		return nil, err
+	}
+
+	err = DefaultValues.Set(cacheKey, day, date.AddDate(0, 0, 1))
+	if err != nil {
+		w.logr.Println("warning: failed to cache sunrise result:", err)
+	}
+	return &day, nil
+}
+
+func (w *SunriseService) sunrise(client *http.Client, path string, date time.Time, result *SunriseResponse) error {
+	q := url.Values{}
+	q.Add("lat", fmt.Sprintf("%.4f", w.lat))
+	q.Add("lon", fmt.Sprintf("%.4f", w.lon))
+	q.Add("date", date.Format("2006-01-02"))
+	q.Add("offset", date.Format("-07:00"))
+
+	return w.apiGet(client, path, q, result)
+}
+
+// SunriseResponse is the response of both the sun and moon
+// endpoints, only the events of the body are set
+type SunriseResponse struct {
+	Type       string `json:"type"`
+	Properties struct {
+		Body string `json:"body"`
+
+		Sunrise       *sunriseEvent `json:"sunrise,omitempty"`
+		Sunset        *sunriseEvent `json:"sunset,omitempty"`
+		SolarNoon     *sunriseEvent `json:"solarnoon,omitempty"`
+		SolarMidnight *sunriseEvent `json:"solarmidnight,omitempty"`
+
+		Moonrise  *sunriseEvent `json:"moonrise,omitempty"`
+		Moonset   *sunriseEvent `json:"moonset,omitempty"`
+		HighMoon  *sunriseEvent `json:"high_moon,omitempty"`
+		LowMoon   *sunriseEvent `json:"low_moon,omitempty"`
+		MoonPhase float64       `json:"moonphase"`
+	} `json:"properties"`
+}
+
+type sunriseEvent struct {
+	Time      sunriseTime `json:"time"`
+	Azimuth   float64     `json:"azimuth,omitempty"`
+	Elevation float64     `json:"disc_centre_elevation,omitempty"`
+	Visible   bool        `json:"visible,omitempty"`
+}
+
+// sunriseTime is a time of the sunrise api, which leaves out
+// the seconds, and is null when the event doesn't happen
+type sunriseTime struct {
+	time.Time
+}
+
+func (t *sunriseTime) UnmarshalJSON(b []byte) error {
+	str := strings.Trim(string(b), `"`)
+	if str == "null" || str == "" {
+		return nil
+	}
+	var err error
+	for _, layout := range []string{"2006-01-02T15:04Z07:00", time.RFC3339} {
+		t.Time, err = time.Parse(layout, str)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (t sunriseTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time)
+}
@@ -0,0 +1,207 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Met Norway integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// symbol codes: https://api.met.no/weatherapi/weathericon/2.0/documentation
+
+package metno
+
+import (
+	"strings"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+)
+
+// symbol is a parsed symbol code, ie. lightrainshowersandthunder_day
+type symbol struct {
+	sky       string // clearsky, fair, partlycloudy, cloudy or fog
+	intensity string // light, heavy or none
+	precip    string // rain, sleet or snow
+	showers   bool
+	thunder   bool
+	variant   string // day, night, polartwilight or none
+}
+
+func parseSymbol(code string) symbol {
+	var sym symbol
+
+	base := code
+	if i := strings.IndexByte(code, '_'); i >= 0 {
+		base, sym.variant = code[:i], code[i+1:]
+	}
+	switch base {
+	case "clearsky", "fair", "partlycloudy", "cloudy", "fog":
+		sym.sky = base
+		return sym
+	}
+
+	// MET spells a few codes with 'lightss', ie. lightssnowshowersandthunder
+	if strings.HasPrefix(base, "lightss") {
+		base = "light" + base[len("lights"):]
+	}
+	base, sym.thunder = trimSuffix(base, "andthunder")
+	base, sym.showers = trimSuffix(base, "showers")
+	for _, intensity := range []string{"light", "heavy"} {
+		if strings.HasPrefix(base, intensity) {
+			sym.intensity = intensity
+			base = base[len(intensity):]
+		}
+	}
+	sym.precip = base
+	return sym
+}
+
+func trimSuffix(s, suffix string) (string, bool) {
+	if strings.HasSuffix(s, suffix) {
+		return s[:len(s)-len(suffix)], true
+	}
+	return s, false
+}
+
+var skyConditions = map[string]string{
+	"clearsky":     ConditionClear,
+	"fair":         ConditionMostlyClear,
+	"partlycloudy": ConditionPartlyCloudy,
+	"cloudy":       ConditionCloudy,
+	"fog":          ConditionFog,
+}
+
+// condition is the normalized condition shared with the other
+// sources, showers are the same as continuous precipitation
+func (sym symbol) condition() string {
+	switch {
+	case sym.sky != "":
+		return skyConditions[sym.sky]
+	case sym.thunder:
+		return ConditionThunder
+	case sym.intensity == "":
+		return sym.precip
+	}
+	return sym.intensity + "_" + sym.precip
+}
+
+// summaryWords are the words of the summary in each language
+type summaryWords struct {
+	sky     map[string]string
+	precip  map[string]string
+	light   string
+	heavy   string
+	showers func(precip string) string
+	// showers are plural in some languages
+	lightShowers string
+	heavyShowers string
+	thunder      string
+}
+
+var summaryLanguages = map[string]summaryWords{
+	"en": {
+		sky: map[string]string{
+			"clearsky":     "clear sky",
+			"fair":         "fair",
+			"partlycloudy": "partly cloudy",
+			"cloudy":       "cloudy",
+			"fog":          "fog",
+		},
+		precip:       map[string]string{"rain": "rain", "sleet": "sleet", "snow": "snow"},
+		light:        "light ",
+		heavy:        "heavy ",
+		showers:      func(precip string) string { return precip + " showers" },
+		lightShowers: "light ",
+		heavyShowers: "heavy ",
+		thunder:      " and thunder",
+	},
+	"nb": {
+		sky: map[string]string{
+			"clearsky":     "klarvær",
+			"fair":         "lettskyet",
+			"partlycloudy": "delvis skyet",
+			"cloudy":       "skyet",
+			"fog":          "tåke",
+		},
+		precip:       map[string]string{"rain": "regn", "sleet": "sludd", "snow": "snø"},
+		light:        "lett ",
+		heavy:        "kraftig ",
+		showers:      func(precip string) string { return precip + "byger" },
+		lightShowers: "lette ",
+		heavyShowers: "kraftige ",
+		thunder:      " og torden",
+	},
+}
+
+// summary is the human readable symbol in the language,
+// ie. "Light rain showers and thunder"
+func (sym symbol) summary(lang string) string {
+	words := summaryLanguages[lang]
+
+	var text string
+	if sym.sky != "" {
+		text = words.sky[sym.sky]
+	} else {
+		light, heavy := words.light, words.heavy
+		text = words.precip[sym.precip]
+		if sym.showers {
+			text = words.showers(text)
+			light, heavy = words.lightShowers, words.heavyShowers
+		}
+		switch sym.intensity {
+		case "light":
+			text = light + text
+		case "heavy":
+			text = heavy + text
+		}
+		if sym.thunder {
+			text += words.thunder
+		}
+	}
+	if text == "" {
+		return ""
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// addConditions adds the condition, summary, icon and daylight
+// fields for the symbol of each period. The next hour has the
+// plain names, the next 6 and 12 hours add a _6h or _12h suffix
+func (s *MetNoTimestep) addConditions(fields map[string]integrations.Field, lang string) {
+	periods := []struct {
+		period *MetNoPeriod
+		suffix string
+	}{
+		{&s.Data.Next1Hours, ""},
+		{&s.Data.Next6Hours, "_6h"},
+		{&s.Data.Next12Hours, "_12h"},
+	}
+	for _, p := range periods {
+		code := p.period.Summary.SymbolCode
+		if code == "" {
+			continue
+		}
+		sym := parseSymbol(code)
+
+		// the weathericons of MET are named by symbol code
+		fields[ConditionIcon+p.suffix] = integrations.Field{Value: code, Unit: Text}
+		if condition := sym.condition(); condition != "" {
+			fields[NormalizedCondition+p.suffix] = integrations.Field{Value: condition, Unit: Text}
+		}
+		if summary := sym.summary(lang); summary != "" {
+			fields[Summary+p.suffix] = integrations.Field{Value: summary, Unit: Text}
+		}
+		if sym.variant != "" {
+			fields[Daylight+p.suffix] = integrations.Field{Value: sym.variant, Unit: Text}
+		}
+	}
+}
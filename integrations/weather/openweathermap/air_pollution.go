@@ -0,0 +1,152 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     OpenWeatherMap integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://openweathermap.org/api/air-pollution
+
+package openweathermap
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+)
+
+var AirPollutionName = "openweathermap_air"
+
+type AirPollutionService struct {
+	api
+	forecast bool
+}
+
+func (w *AirPollutionService) Init(args map[string]interface{}) error {
+	err := w.api.init(args, "open_weather_map air source: ", true)
+	if err != nil {
+		return err
+	}
+
+	// the forecast is hourly, for the next 4 days
+	w.forecast, _ = args["forecast"].(bool)
+
+	w.logr.Println("Initialized!")
+	return nil
+}
+
+func (w *AirPollutionService) Query() (integrations.Data, error) {
+	w.logr.Println("querying OpenWeather air pollution")
+
+	lat, lon, err := w.location()
+	if err != nil {
+		return integrations.Data{}, err
+	}
+	current, err := w.airPollutionQuery(w.client, "/data/2.5/air_pollution", lat, lon)
+	if err != nil {
+		w.logr.Println("openweather.airPollutionQuery failed")
+		return integrations.Data{}, err
+	}
+	if len(current.List) == 0 {
+		w.logr.Println("error: response is missing air pollution data")
+		return integrations.Data{}, fmt.Errorf("openweather air pollution response is empty")
+	}
+	return current.List[0].record("current"), nil
+}
+
+// QueryAll returns current air pollution, and the
+// hourly forecast when enabled
+func (w *AirPollutionService) QueryAll() ([]integrations.Data, error) {
+	current, err := w.Query()
+	if err != nil {
+		return nil, err
+	}
+	records := []integrations.Data{current}
+	if !w.forecast {
+		return records, nil
+	}
+
+	// already resolved by Query
+	lat, lon, _ := w.location()
+	forecast, err := w.airPollutionQuery(w.client, "/data/2.5/air_pollution/forecast", lat, lon)
+	if err != nil {
+		w.logr.Println("openweather.airPollutionQuery (forecast) failed")
+		return nil, err
+	}
+	for _, entry := range forecast.List {
+		records = append(records, entry.record("hourly"))
+	}
+	return records, nil
+}
+
+func (w *AirPollutionService) airPollutionQuery(client *http.Client, path string, lat, lon float64) (*AirPollutionResponse, error) {
+	q := url.Values{}
+	q.Add("lat", fmt.Sprintf("%.4f", lat))
+	q.Add("lon", fmt.Sprintf("%.4f", lon))
+
+	result := AirPollutionResponse{}
+	err := w.apiGet(client, path, q, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type airPollutionEntry struct {
+	Time int64 `json:"dt"`
+	Main struct {
+		AQI int `json:"aqi"`
+	} `json:"main"`
+	Components struct {
+		CO   float32 `json:"co"`
+		NO   float32 `json:"no"`
+		NO2  float32 `json:"no2"`
+		O3   float32 `json:"o3"`
+		SO2  float32 `json:"so2"`
+		PM25 float32 `json:"pm2_5"`
+		PM10 float32 `json:"pm10"`
+		NH3  float32 `json:"nh3"`
+	} `json:"components"`
+}
+
+func (e airPollutionEntry) record(forecast string) integrations.Data {
+	return integrations.Data{
+		Time: time.Unix(e.Time, 0),
+		Tags: map[string]string{ForecastTag: forecast},
+
+		Fields: map[string]integrations.Field{
+			// 1 = Good, 2 = Fair, 3 = Moderate, 4 = Poor, 5 = Very Poor
+			AirQualityIndex: {Value: e.Main.AQI, Unit: AQI},
+			CarbonMonoxide:  {Value: e.Components.CO, Unit: MicrogramsPerCubicMeter},
+			NitrogenOxide:   {Value: e.Components.NO, Unit: MicrogramsPerCubicMeter},
+			NitrogenDioxide: {Value: e.Components.NO2, Unit: MicrogramsPerCubicMeter},
+			Ozone:           {Value: e.Components.O3, Unit: MicrogramsPerCubicMeter},
+			SulphurDioxide:  {Value: e.Components.SO2, Unit: MicrogramsPerCubicMeter},
+			PM2_5:           {Value: e.Components.PM25, Unit: MicrogramsPerCubicMeter},
+			PM10:            {Value: e.Components.PM10, Unit: MicrogramsPerCubicMeter},
+			Ammonia:         {Value: e.Components.NH3, Unit: MicrogramsPerCubicMeter},
+		},
+	}
+}
+
+type AirPollutionResponse struct {
+	Location struct {
+		Longitude float64 `json:"lon"`
+		Latitude  float64 `json:"lat"`
+	} `json:"coord"`
+	List []airPollutionEntry `json:"list"`
+}
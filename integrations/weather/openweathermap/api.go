@@ -0,0 +1,178 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     OpenWeatherMap integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// https://openweathermap.org/
+
+package openweathermap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	. "github.com/jpxor/go-weather-reporter/pkg/httphelper"
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
+)
+
+// api holds what every openweathermap source shares: the apikey,
+// the location, and a client that is cached and rate limited
+// per account
+type api struct {
+	client  *http.Client
+	logr    *log.Logger
+	limiter *RateLimiter
+	baseURL *url.URL
+	apikey  string
+	lat     float64
+	lon     float64
+	geocode *geocodeQuery
+}
+
+// init reads the config shared by all sources, the location is
+// optional for sources that take a batch of locations instead
+func (w *api) init(args map[string]interface{}, logPrefix string, needLocation bool) error {
+	var ok bool
+	var err error
+
+	w.logr = log.New(log.Writer(), logPrefix, log.LstdFlags|log.Lmsgprefix)
+
+	w.apikey, ok = args["apikey"].(string)
+	if !ok {
+		w.logr.Println("missing required 'apikey'")
+		return fmt.Errorf("configuration missing required field")
+	}
+
+	if needLocation {
+		err = w.parseLocation(args)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.baseURL, err = BaseURL(args, DefaultBaseURL)
+	if err != nil {
+		w.logr.Println(err)
+		return err
+	}
+
+	// openweathermap.org free-tier allows 60 calls per minute,
+	// the limit is per account so all services using the same
+	// apikey share a limiter
+	rates, err := SourceRates(args["rate_limit"], PerMinute(60))
+	if err != nil {
+		w.logr.Println(err)
+		return err
+	}
+	w.limiter = SharedRateLimiter(w.baseURL.Host, w.apikey, rates...)
+
+	// responses are cached for 10 minutes unless their
+	// Cache-Control or Expires headers say otherwise.
+	// From https://openweathermap.org
+	//    " First, we recommend making API calls no more than once in 10 minutes for
+	//      each location, whether you call it by city name, geographical coordinates
+	//      or by zip code. The update frequency of the OpenWeather model is not
+	//      higher than once in 10 minutes. "
+	w.client, err = NewSourceClient(args, 10*time.Second, w.limiter, 10*time.Minute, w.logr)
+	if err != nil {
+		w.logr.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (w *api) SecretKeys() []string {
+	return []string{"apikey"}
+}
+
+// apiGet sends a GET request for an api path, with the apikey added
+// to the query, and decodes the json response into result
+func (w *api) apiGet(client *http.Client, path string, q url.Values, result interface{}) error {
+
+	// NOTE: The endpoint for paid subscription plans is different,
+	// set base_url: https://pro.openweathermap.org to use it
+	endpoint := Endpoint(w.baseURL, path)
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		w.logr.Println("error: failed to create http request", err)
+		return err
+	}
+
+	q.Set("appid", w.apikey)
+	req.URL.RawQuery = q.Encode()
+
+	req.Header.Add("Accept", "application/json")
+	req.Header.Set("User-Agent", "go-weather-reporter client (https://github.com/jpxor/go-weather-reporter)")
+
+	res, err := client.Do(req)
+	if err != nil {
+		// the request url includes the apikey
+		err = redact.Error(err)
+		w.logr.Println("error: failed to send http request", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.Header.Get(CacheStatusHeader) {
+	case CacheHit:
+		w.logr.Println("info: openweather using cached result (not yet expired)")
+	case CacheRevalidated:
+		w.logr.Println("info: openweather using cached result (data not modified)")
+	case CacheMiss:
+		w.logr.Println("caching result | expires header:", res.Header.Get("Expires"))
+	}
+
+	err = CheckResponse(res)
+	if err != nil {
+		switch {
+		case res.StatusCode == 429:
+			w.logr.Println("warning: your OpenWeatherMap.org account is temporary blocked due to exceeding of requests limitation of your subscription type", endpoint)
+		case res.StatusCode == 403:
+			w.logr.Println("error: access forbidden", endpoint)
+		case errors.Is(err, ClientErrorRetry):
+			w.logr.Println("Note: if you recently created the OpenWeatherMap api-key, try again in a few minutes")
+		}
+		w.logr.Println("error:", err)
+		return err
+	}
+
+	if deprecation := CheckDeprecation(res); deprecation != nil {
+		w.logr.Println("warning:", deprecation)
+		w.logr.Println("  |>> options: update, create pull request, or open an issue")
+		w.logr.Println("  |>> see: https://github.com/jpxor/go-weather-reporter/issues")
+	}
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		w.logr.Println("error: failed to read response from", endpoint)
+		return err
+	}
+
+	err = json.Unmarshal(buf, result)
+	if err != nil {
+		w.logr.Println("error: failed to parse response from", endpoint)
+		w.logr.Println(err)
+		return err
+	}
+	return nil
+}
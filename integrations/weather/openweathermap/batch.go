@@ -0,0 +1,191 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     OpenWeatherMap integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://openweathermap.org/current#severalid
+
+package openweathermap
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+)
+
+// CityTag is the tag naming the location of each
+// record of a batch query
+const CityTag = "city"
+
+// groupLimit is the most city ids the group endpoint
+// accepts in one call
+const groupLimit = 20
+
+// batchLocation is one location of a batch, either a city id
+// or coordinates. The name defaults to the city name returned
+// by the api
+type batchLocation struct {
+	name   string
+	cityID int
+	lat    float64
+	lon    float64
+}
+
+// parseBatch reads the 'batch' list of the config, each entry is
+// a city id, or a map with 'city_id' or 'latitude' and 'longitude',
+// and an optional 'name'
+func (w *OpenWeatherService) parseBatch(batch interface{}) error {
+	entries, ok := batch.([]interface{})
+	if !ok || len(entries) == 0 {
+		w.logr.Println("'batch' must be a list of city ids or locations")
+		return fmt.Errorf("configuration has invalid field")
+	}
+	for i, entry := range entries {
+		var loc batchLocation
+
+		switch entry := entry.(type) {
+		case int:
+			loc.cityID = entry
+
+		case map[interface{}]interface{}:
+			loc.name, _ = entry["name"].(string)
+			id, hasID := entry["city_id"].(int)
+			lat, hasLat := toFloat(entry["latitude"])
+			lon, hasLon := toFloat(entry["longitude"])
+			switch {
+			case hasID && (hasLat || hasLon):
+				w.logr.Println("batch entry", i, "sets both 'city_id' and coordinates")
+				return fmt.Errorf("configuration has conflicting fields")
+			case hasID:
+				loc.cityID = id
+			case !hasLat || !hasLon:
+				w.logr.Println("batch entry", i, "is missing 'city_id' or 'latitude' and 'longitude'")
+				return fmt.Errorf("configuration missing required field")
+			default:
+				loc.lat, loc.lon = lat, lon
+			}
+
+		default:
+			w.logr.Println("batch entry", i, "must be a city id or a location")
+			return fmt.Errorf("configuration has invalid field")
+		}
+		w.batch = append(w.batch, loc)
+	}
+	return nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// batchQuery returns one record per location of the batch. City ids
+// are fetched up to 20 per call from the group endpoint, there is no
+// bulk endpoint for coordinates so those take one call each. All
+// calls go through the shared rate limiter
+func (w *OpenWeatherService) batchQuery() ([]integrations.Data, error) {
+	w.logr.Println("querying OpenWeather for", len(w.batch), "locations")
+
+	// responses in the order of the batch
+	responses := make([]*OpenWeatherResponse, len(w.batch))
+
+	var ids []int
+	for i, loc := range w.batch {
+		if loc.cityID != 0 {
+			ids = append(ids, i)
+			continue
+		}
+		current, err := w.currentWeatherQuery(w.client, loc.lat, loc.lon)
+		if err != nil {
+			w.logr.Println("openweather.currentWeatherQuery failed")
+			return nil, err
+		}
+		responses[i] = current
+	}
+
+	for start := 0; start < len(ids); start += groupLimit {
+		end := start + groupLimit
+		if end > len(ids) {
+			end = len(ids)
+		}
+		group, err := w.groupQuery(ids[start:end])
+		if err != nil {
+			w.logr.Println("openweather.groupQuery failed")
+			return nil, err
+		}
+		byID := make(map[int]*OpenWeatherResponse, len(group.List))
+		for i := range group.List {
+			byID[group.List[i].ID] = &group.List[i]
+		}
+		for _, i := range ids[start:end] {
+			responses[i] = byID[w.batch[i].cityID]
+		}
+	}
+
+	units := unitSystems[w.units]
+	var records []integrations.Data
+
+	for i, r := range responses {
+		loc := w.batch[i]
+		if r == nil {
+			w.logr.Println("warning: response is missing city id", loc.cityID)
+			continue
+		}
+		name := loc.name
+		if name == "" {
+			name = r.Name
+		}
+		records = append(records, integrations.Data{
+			Time:   time.Unix(r.Time, 0),
+			Fields: r.fields(units),
+			Tags:   map[string]string{CityTag: name},
+		})
+	}
+	return records, nil
+}
+
+// groupQuery fetches the current weather of the batch
+// locations at the given indices, by city id
+func (w *OpenWeatherService) groupQuery(indices []int) (*GroupResponse, error) {
+	ids := make([]string, len(indices))
+	for n, i := range indices {
+		ids[n] = strconv.Itoa(w.batch[i].cityID)
+	}
+	q := url.Values{}
+	q.Add("id", strings.Join(ids, ","))
+	q.Add("units", w.units)
+	q.Add("lang", w.lang)
+
+	result := GroupResponse{}
+	err := w.apiGet(w.client, "/data/2.5/group", q, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type GroupResponse struct {
+	Count int                   `json:"cnt"`
+	List  []OpenWeatherResponse `json:"list"`
+}
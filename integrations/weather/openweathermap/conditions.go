@@ -0,0 +1,82 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     OpenWeatherMap integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://openweathermap.org/weather-conditions
+
+package openweathermap
+
+import (
+	"strings"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+)
+
+// normalizedCondition maps an openweathermap condition id to the
+// condition shared by all sources. Mist, haze, smoke, dust and
+// the other atmosphere conditions are all fog
+func normalizedCondition(id int) string {
+	switch {
+	case id >= 200 && id < 300:
+		return ConditionThunder
+	case id >= 300 && id < 400:
+		return ConditionLightRain
+	case id == 500 || id == 520:
+		return ConditionLightRain
+	case id == 502 || id == 503 || id == 504 || id == 522:
+		return ConditionHeavyRain
+	case id == 511:
+		return ConditionSleet
+	case id >= 500 && id < 600:
+		return ConditionRain
+	case id == 600 || id == 620:
+		return ConditionLightSnow
+	case id == 602 || id == 622:
+		return ConditionHeavySnow
+	case id == 615:
+		return ConditionLightSleet
+	case id >= 611 && id <= 616:
+		return ConditionSleet
+	case id >= 600 && id < 700:
+		return ConditionSnow
+	case id >= 700 && id < 800:
+		return ConditionFog
+	case id == 800:
+		return ConditionClear
+	case id == 801:
+		return ConditionMostlyClear
+	case id == 802 || id == 803:
+		return ConditionPartlyCloudy
+	case id == 804:
+		return ConditionCloudy
+	}
+	return ""
+}
+
+// addCondition adds the normalized condition, and day or
+// night from the suffix of the icon, ie. 01d or 01n
+func addCondition(fields map[string]integrations.Field, id int, icon string) {
+	if condition := normalizedCondition(id); condition != "" {
+		fields[NormalizedCondition] = integrations.Field{Value: condition, Unit: Text}
+	}
+	switch {
+	case strings.HasSuffix(icon, "d"):
+		fields[Daylight] = integrations.Field{Value: Day, Unit: Text}
+	case strings.HasSuffix(icon, "n"):
+		fields[Daylight] = integrations.Field{Value: Night, Unit: Text}
+	}
+}
@@ -0,0 +1,146 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     OpenWeatherMap integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://openweathermap.org/api/geocoding-api
+
+package openweathermap
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	. "github.com/jpxor/go-weather-reporter/pkg/httphelper"
+)
+
+// coordinates don't move, so resolved locations are kept
+// for a long time (on disk when -cache-dir is set)
+const geocodeTTL = 365 * 24 * time.Hour
+
+// geocodeQuery is a location given by one of
+// 'city', 'zip' or 'city_id' instead of coordinates
+type geocodeQuery struct {
+	key   string
+	value string
+}
+
+type coordinates struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+// parseLocation reads the location of the config, either the
+// latitude and longitude, or one location to be geocoded
+func (w *api) parseLocation(args map[string]interface{}) error {
+	var queries []geocodeQuery
+	for _, key := range []string{"city", "zip", "city_id"} {
+		switch val := args[key].(type) {
+		case string:
+			queries = append(queries, geocodeQuery{key: key, value: val})
+		case int:
+			queries = append(queries, geocodeQuery{key: key, value: fmt.Sprint(val)})
+		}
+	}
+	lat, hasLat := args["latitude"].(float64)
+	lon, hasLon := args["longitude"].(float64)
+
+	switch {
+	case len(queries) > 1 || (len(queries) == 1 && (hasLat || hasLon)):
+		w.logr.Println("set only one of 'latitude'/'longitude', 'city', 'zip' or 'city_id'")
+		return fmt.Errorf("configuration has conflicting fields")
+	case len(queries) == 1:
+		w.geocode = &queries[0]
+	case !hasLat:
+		w.logr.Println("missing required 'latitude'")
+		return fmt.Errorf("configuration missing required field")
+	case !hasLon:
+		w.logr.Println("missing required 'longitude'")
+		return fmt.Errorf("configuration missing required field")
+	default:
+		w.lat, w.lon = lat, lon
+	}
+	return nil
+}
+
+// location returns the coordinates to query, a city, zip
+// or city_id is resolved on first use
+func (w *api) location() (float64, float64, error) {
+	if w.geocode == nil {
+		return w.lat, w.lon, nil
+	}
+	coords, err := w.resolve(*w.geocode)
+	if err != nil {
+		w.logr.Println("failed to resolve location", w.geocode.key, w.geocode.value)
+		return 0, 0, err
+	}
+	w.logr.Printf("resolved %s %q to latitude %.4f, longitude %.4f\n", w.geocode.key, w.geocode.value, coords.Latitude, coords.Longitude)
+	w.lat, w.lon = coords.Latitude, coords.Longitude
+	w.geocode = nil
+	return w.lat, w.lon, nil
+}
+
+func (w *api) resolve(query geocodeQuery) (coordinates, error) {
+	var coords coordinates
+
+	cacheKey := "openweathermap-geocode:" + query.key + "=" + query.value
+	if DefaultValues.Get(cacheKey, &coords) {
+		return coords, nil
+	}
+
+	q := url.Values{}
+	switch query.key {
+	case "city":
+		var results []coordinates
+		q.Add("q", query.value)
+		q.Add("limit", "1")
+		err := w.apiGet(w.client, "/geo/1.0/direct", q, &results)
+		if err != nil {
+			return coords, err
+		}
+		if len(results) == 0 {
+			return coords, fmt.Errorf("openweather geocoding: no match for city %q", query.value)
+		}
+		coords = results[0]
+
+	case "zip":
+		q.Add("zip", query.value)
+		err := w.apiGet(w.client, "/geo/1.0/zip", q, &coords)
+		if err != nil {
+			return coords, err
+		}
+
+	case "city_id":
+		// there is no geocoding endpoint for city ids, but
+		// current weather by id includes the coordinates
+		var result OpenWeatherResponse
+		q.Add("id", query.value)
+		err := w.apiGet(w.client, "/data/2.5/weather", q, &result)
+		if err != nil {
+			return coords, err
+		}
+		coords = coordinates{
+			Latitude:  result.Location.Latitude,
+			Longitude: result.Location.Longitude,
+		}
+	}
+
+	err := DefaultValues.Set(cacheKey, coords, time.Now().Add(geocodeTTL))
+	if err != nil {
+		w.logr.Println("warning: failed to cache resolved location:", err)
+	}
+	return coords, nil
+}
@@ -0,0 +1,285 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     OpenWeatherMap integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// api reference: https://openweathermap.org/api/one-call-3
+
+package openweathermap
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+)
+
+func (w *OpenWeatherService) oneCallQuery(client *http.Client, lat, lon float64) (*OneCallResponse, error) {
+	q := url.Values{}
+	q.Add("lat", fmt.Sprintf("%.4f", lat))
+	q.Add("lon", fmt.Sprintf("%.4f", lon))
+	q.Add("units", w.units)
+	q.Add("lang", w.lang)
+	if len(w.exclude) > 0 {
+		q.Add("exclude", strings.Join(w.exclude, ","))
+	}
+
+	result := OneCallResponse{}
+	err := w.apiGet(client, "/data/3.0/onecall", q, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AlertTag is the tag naming the event of an alert record
+const AlertTag = "alert"
+
+// oneCallRecords maps a One Call response to one record per
+// timestamp, tagged with the part of the response it came from
+func (w *OpenWeatherService) oneCallRecords(resp *OneCallResponse) []integrations.Data {
+	units := unitSystems[w.units]
+	records := make([]integrations.Data, 0, 1+len(resp.Minutely)+len(resp.Hourly)+len(resp.Daily)+len(resp.Alerts))
+
+	// current is missing when excluded
+	if resp.Current.Time != 0 {
+		records = append(records, integrations.Data{
+			Time:   time.Unix(resp.Current.Time, 0),
+			Tags:   map[string]string{ForecastTag: "current"},
+			Fields: resp.Current.fields(units),
+		})
+	}
+
+	for _, minute := range resp.Minutely {
+		records = append(records, integrations.Data{
+			Time: time.Unix(minute.Time, 0),
+			Tags: map[string]string{ForecastTag: "minutely"},
+			Fields: map[string]integrations.Field{
+				Precipitation: {
+					Value: minute.Precipitation,
+					Unit:  MillimetersPerHour,
+				},
+			},
+		})
+	}
+
+	for _, hour := range resp.Hourly {
+		fields := hour.fields(units)
+		fields[PrecipitationProbability] = integrations.Field{
+			Value: hour.POP * 100,
+			Unit:  Percent,
+		}
+		records = append(records, integrations.Data{
+			Time:   time.Unix(hour.Time, 0),
+			Tags:   map[string]string{ForecastTag: "hourly"},
+			Fields: fields,
+		})
+	}
+
+	for _, day := range resp.Daily {
+		records = append(records, integrations.Data{
+			Time:   time.Unix(day.Time, 0),
+			Tags:   map[string]string{ForecastTag: "daily"},
+			Fields: day.fields(units),
+		})
+	}
+
+	// alerts are tagged with their event, so alerts that start at
+	// the same time are separate points. Repeats of an event at the
+	// same time, ie. from several senders, are numbered
+	seen := make(map[string]int)
+	for _, alert := range resp.Alerts {
+		event := alert.Event
+		key := fmt.Sprint(alert.Start, event)
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			event = fmt.Sprintf("%s #%d", event, n)
+		}
+		records = append(records, integrations.Data{
+			Time: time.Unix(alert.Start, 0),
+			Tags: map[string]string{ForecastTag: "alert", AlertTag: event},
+			Fields: map[string]integrations.Field{
+				AlertEvent:       {Value: alert.Event, Unit: Text},
+				AlertSender:      {Value: alert.SenderName, Unit: Text},
+				AlertDescription: {Value: alert.Description, Unit: Text},
+				AlertStart:       {Value: time.Unix(alert.Start, 0), Unit: Time},
+				AlertEnd:         {Value: time.Unix(alert.End, 0), Unit: Time},
+				AlertTags:        {Value: strings.Join(alert.Tags, ","), Unit: Text},
+			},
+		})
+	}
+	return records
+}
+
+type oneCallWeather []struct {
+	ID          int    `json:"id"`
+	Main        string `json:"main"`
+	Description string `json:"description"`
+	IconID      string `json:"icon"`
+}
+
+// addTo adds the weather condition fields, if any
+func (wc oneCallWeather) addTo(fields map[string]integrations.Field) {
+	if len(wc) == 0 {
+		return
+	}
+	fields[Condition] = integrations.Field{Value: wc[0].Main, Unit: Text}
+	fields[Description] = integrations.Field{Value: wc[0].Description, Unit: Text}
+	fields[ConditionCode] = integrations.Field{Value: wc[0].ID, Unit: Index}
+	fields[ConditionIcon] = integrations.Field{Value: wc[0].IconID, Unit: Text}
+	addCondition(fields, wc[0].ID, wc[0].IconID)
+}
+
+type oneCallConditions struct {
+	Time       int64   `json:"dt"`
+	Sunrise    int64   `json:"sunrise"`
+	Sunset     int64   `json:"sunset"`
+	Temp       float32 `json:"temp"`
+	FeelsLike  float32 `json:"feels_like"`
+	Pressure   float32 `json:"pressure"`
+	Humidity   float32 `json:"humidity"`
+	DewPoint   float32 `json:"dew_point"`
+	UVI        float32 `json:"uvi"`
+	Clouds     float32 `json:"clouds"`
+	Visibility float32 `json:"visibility"`
+	WindSpeed  float32 `json:"wind_speed"`
+	WindDeg    float32 `json:"wind_deg"`
+	WindGust   float32 `json:"wind_gust"`
+	POP        float32 `json:"pop"`
+	Rain       struct {
+		OneHour float32 `json:"1h"`
+	} `json:"rain"`
+	Snow struct {
+		OneHour float32 `json:"1h"`
+	} `json:"snow"`
+	Weather oneCallWeather `json:"weather"`
+}
+
+func (c oneCallConditions) fields(units unitSystem) map[string]integrations.Field {
+	fields := map[string]integrations.Field{
+		Temperature:   {Value: c.Temp, Unit: units.temperature},
+		FeelsLike:     {Value: c.FeelsLike, Unit: units.temperature},
+		Pressure:      {Value: c.Pressure, Unit: HectoPascal},
+		RelHumidity:   {Value: c.Humidity, Unit: Percent},
+		DewPoint:      {Value: c.DewPoint, Unit: units.temperature},
+		UVIndex:       {Value: c.UVI, Unit: Index},
+		CloudCover:    {Value: c.Clouds, Unit: Percent},
+		Visibility:    {Value: c.Visibility, Unit: Meters},
+		WindSpeed:     {Value: c.WindSpeed, Unit: units.speed},
+		WindDirection: {Value: c.WindDeg, Unit: Degrees},
+		WindGust:      {Value: c.WindGust, Unit: units.speed},
+		Rain:          {Value: c.Rain.OneHour, Unit: MillimetersPerHour},
+		Snow:          {Value: c.Snow.OneHour, Unit: MillimetersPerHour},
+	}
+	// only current conditions have sunrise and sunset
+	if c.Sunrise != 0 {
+		fields[Sunrise] = integrations.Field{Value: time.Unix(c.Sunrise, 0), Unit: Time}
+		fields[Sunset] = integrations.Field{Value: time.Unix(c.Sunset, 0), Unit: Time}
+	}
+	c.Weather.addTo(fields)
+	return fields
+}
+
+type oneCallDay struct {
+	Time      int64   `json:"dt"`
+	Sunrise   int64   `json:"sunrise"`
+	Sunset    int64   `json:"sunset"`
+	Moonrise  int64   `json:"moonrise"`
+	Moonset   int64   `json:"moonset"`
+	MoonPhase float32 `json:"moon_phase"`
+	Summary   string  `json:"summary"`
+	Temp      struct {
+		Day   float32 `json:"day"`
+		Min   float32 `json:"min"`
+		Max   float32 `json:"max"`
+		Night float32 `json:"night"`
+		Eve   float32 `json:"eve"`
+		Morn  float32 `json:"morn"`
+	} `json:"temp"`
+	FeelsLike struct {
+		Day   float32 `json:"day"`
+		Night float32 `json:"night"`
+		Eve   float32 `json:"eve"`
+		Morn  float32 `json:"morn"`
+	} `json:"feels_like"`
+	Pressure  float32        `json:"pressure"`
+	Humidity  float32        `json:"humidity"`
+	DewPoint  float32        `json:"dew_point"`
+	WindSpeed float32        `json:"wind_speed"`
+	WindDeg   float32        `json:"wind_deg"`
+	WindGust  float32        `json:"wind_gust"`
+	Clouds    float32        `json:"clouds"`
+	UVI       float32        `json:"uvi"`
+	POP       float32        `json:"pop"`
+	Rain      float32        `json:"rain"`
+	Snow      float32        `json:"snow"`
+	Weather   oneCallWeather `json:"weather"`
+}
+
+func (d oneCallDay) fields(units unitSystem) map[string]integrations.Field {
+	fields := map[string]integrations.Field{
+		Temperature:              {Value: d.Temp.Day, Unit: units.temperature},
+		TemperatureMin:           {Value: d.Temp.Min, Unit: units.temperature},
+		TemperatureMax:           {Value: d.Temp.Max, Unit: units.temperature},
+		FeelsLike:                {Value: d.FeelsLike.Day, Unit: units.temperature},
+		Pressure:                 {Value: d.Pressure, Unit: HectoPascal},
+		RelHumidity:              {Value: d.Humidity, Unit: Percent},
+		DewPoint:                 {Value: d.DewPoint, Unit: units.temperature},
+		UVIndex:                  {Value: d.UVI, Unit: Index},
+		CloudCover:               {Value: d.Clouds, Unit: Percent},
+		WindSpeed:                {Value: d.WindSpeed, Unit: units.speed},
+		WindDirection:            {Value: d.WindDeg, Unit: Degrees},
+		WindGust:                 {Value: d.WindGust, Unit: units.speed},
+		PrecipitationProbability: {Value: d.POP * 100, Unit: Percent},
+		Rain:                     {Value: d.Rain, Unit: Millimeters},
+		Snow:                     {Value: d.Snow, Unit: Millimeters},
+		Summary:                  {Value: d.Summary, Unit: Text},
+		Sunrise:                  {Value: time.Unix(d.Sunrise, 0), Unit: Time},
+		Sunset:                   {Value: time.Unix(d.Sunset, 0), Unit: Time},
+		Moonrise:                 {Value: time.Unix(d.Moonrise, 0), Unit: Time},
+		Moonset:                  {Value: time.Unix(d.Moonset, 0), Unit: Time},
+		MoonPhase:                {Value: d.MoonPhase, Unit: Fraction},
+	}
+	d.Weather.addTo(fields)
+	return fields
+}
+
+type OneCallResponse struct {
+	Latitude       float64           `json:"lat"`
+	Longitude      float64           `json:"lon"`
+	Timezone       string            `json:"timezone"`
+	TimezoneOffset int               `json:"timezone_offset"`
+	Current        oneCallConditions `json:"current"`
+	Minutely       []struct {
+		Time          int64   `json:"dt"`
+		Precipitation float32 `json:"precipitation"`
+	} `json:"minutely"`
+	Hourly []oneCallConditions `json:"hourly"`
+	Daily  []oneCallDay        `json:"daily"`
+	Alerts []oneCallAlert      `json:"alerts"`
+}
+
+type oneCallAlert struct {
+	SenderName  string   `json:"sender_name"`
+	Event       string   `json:"event"`
+	Start       int64    `json:"start"`
+	End         int64    `json:"end"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
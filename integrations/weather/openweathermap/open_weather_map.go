@@ -21,60 +21,43 @@
 package openweathermap
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/jpxor/go-weather-reporter/integrations"
 	. "github.com/jpxor/go-weather-reporter/integrations/weather"
-	. "github.com/jpxor/go-weather-reporter/pkg/httphelper"
 )
 
+// DefaultBaseURL is used unless the config sets base_url
+const DefaultBaseURL = "https://api.openweathermap.org"
+
 var Name = "openweathermap"
 
-type CachedResult struct {
-	Result       *OpenWeatherResponse
-	Expires      time.Time
-	LastModified time.Time
-}
+const (
+	ModeCurrent = "current"
+	ModeOneCall = "onecall"
+)
 
 type OpenWeatherService struct {
-	client          *http.Client
-	logr            *log.Logger
-	cache           map[string]CachedResult
-	previousRequest time.Time
-	apikey          string
-	lang            string
-	units           string
-	lat             float64
-	lon             float64
+	api
+	lang    string
+	units   string
+	mode    string
+	exclude []string
+	batch   []batchLocation
 }
 
 func (w *OpenWeatherService) Init(args map[string]interface{}) error {
 	var ok bool
 
-	w.logr = log.New(log.Writer(), "open_weather_map source: ", log.LstdFlags|log.Lmsgprefix)
-
-	w.apikey, ok = args["apikey"].(string)
-	if !ok {
-		w.logr.Println("missing required 'apikey'")
-		return fmt.Errorf("configuration missing required field")
-	}
-
-	w.lat, ok = args["latitude"].(float64)
-	if !ok {
-		w.logr.Println("missing required 'latitude'")
-		return fmt.Errorf("configuration missing required field")
-	}
+	// a batch of locations replaces the single location
+	_, isBatch := args["batch"]
 
-	w.lon, ok = args["longitude"].(float64)
-	if !ok {
-		w.logr.Println("missing required 'longitude'")
-		return fmt.Errorf("configuration missing required field")
+	err := w.api.init(args, "open_weather_map source: ", !isBatch)
+	if err != nil {
+		return err
 	}
 
 	w.lang, ok = args["language"].(string)
@@ -88,243 +71,176 @@ func (w *OpenWeatherService) Init(args map[string]interface{}) error {
 		w.logr.Println("missing optional 'units', using default: 'metric'")
 		w.units = "metric"
 	}
-
-	w.cache = make(map[string]CachedResult)
-	w.client = SimpleClient(10 * time.Second)
-
-	w.logr.Println("Initialized!")
-	return nil
-}
-
-func (w *OpenWeatherService) Query() (integrations.Data, error) {
-	w.logr.Println("querying OpenWeather")
-
-	current, err := w.currentWeatherQuery(w.client, w.lat, w.lon)
-	if err != nil {
-		w.logr.Println("openweather.currentWeatherQuery failed")
-		return integrations.Data{}, err
+	if _, ok := unitSystems[w.units]; !ok {
+		w.logr.Println("unknown 'units':", w.units, "expected one of: metric, imperial, standard")
+		return fmt.Errorf("configuration has invalid field")
 	}
 
-	return integrations.Data{
-		Time: time.Unix(current.Time, 0),
-
-		Fields: map[string]integrations.Field{
-			Temperature: {
-				Value: current.Main.Temperature,
-				Unit:  Celcius,
-			},
-			"FeelsLike": {
-				Value: current.Main.FeelsLike,
-				Unit:  Celcius,
-			},
-			RelHumidity: {
-				Value: current.Main.RelHumidity,
-				Unit:  Percent,
-			},
-			Pressure: {
-				Value: current.Main.Pressure,
-				Unit:  HectoPascal,
-			},
-			WindSpeed: {
-				Value: current.Wind.Speed,
-				Unit:  MetersPerSecond,
-			},
-			CloudCover: {
-				Value: current.Clouds.All,
-				Unit:  Percent,
-			},
-			"weather": {
-				Value: current.Weather[0].Main,
-				Unit:  Text,
-			},
-			"sunrise": {
-				Value: time.Unix(current.Sys.Sunrise, 0),
-				Unit:  "Time",
-			},
-			"sunset": {
-				Value: time.Unix(current.Sys.Sunset, 0),
-				Unit:  "Time",
-			},
-		},
-	}, nil
-}
-
-func (w *OpenWeatherService) currentWeatherQuery(client *http.Client, lat, lon float64) (*OpenWeatherResponse, error) {
-
-	cacheHit, lastModified := w.cachedResult(lat, lon)
-	if cacheHit != nil {
-		w.logr.Println("info: openwweather using cached result (not yet expired)")
-		return cacheHit, nil
+	// 'onecall' uses the One Call 3.0 api for current conditions,
+	// forecasts and alerts, it requires a separate subscription
+	w.mode, ok = args["mode"].(string)
+	if !ok {
+		w.mode = ModeCurrent
 	}
-	w.selfThrottle()
-
-	// NOTE: The endpoint for paid subscription plans is different
-	url := "https://api.openweathermap.org/data/2.5/weather"
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		w.logr.Println("error: failed to create http request", err)
-		return nil, err
+	if w.mode != ModeCurrent && w.mode != ModeOneCall {
+		w.logr.Println("unknown 'mode':", w.mode, "expected one of:", ModeCurrent, ModeOneCall)
+		return fmt.Errorf("configuration has invalid field")
 	}
 
-	q := req.URL.Query()
-	q.Add("lat", fmt.Sprintf("%.4f", lat))
-	q.Add("lon", fmt.Sprintf("%.4f", lon))
-	q.Add("units", "metric")
-	q.Add("lang", "en")
-	q.Add("appid", w.apikey)
-	req.URL.RawQuery = q.Encode()
-
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("If-Modified-Since", lastModified.Format(time.RFC1123))
-	req.Header.Set("User-Agent", "go-weather-reporter client (https://github.com/jpxor/go-weather-reporter)")
-
-	res, err := client.Do(req)
-	if err != nil {
-		w.logr.Println("error: failed to send http request", err)
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	// request sent, so track the time for self throttling
-	w.previousRequest = time.Now()
-
-	if ServerErrorStatus(res.StatusCode) {
-		w.logr.Println("warning: server error", url)
-		return nil, ServerErrorRetry
+	// parts of the One Call response to leave out:
+	// current, minutely, hourly, daily, alerts
+	if exclude, ok := args["exclude"].([]interface{}); ok {
+		for _, part := range exclude {
+			str, ok := part.(string)
+			if !ok {
+				w.logr.Println("'exclude' must be a list of strings")
+				return fmt.Errorf("configuration has invalid field")
+			}
+			w.exclude = append(w.exclude, str)
+		}
 	}
 
-	if ClientErrorStatus(res.StatusCode) {
-		if res.StatusCode == 429 {
-			w.logr.Println("warning: your OpenWeatherMap.org account is temporary blocked due to exceeding of requests limitation of your subscription type", url)
-			return nil, ClientErrorFatal
+	if isBatch {
+		if w.mode != ModeCurrent {
+			w.logr.Println("'batch' is only supported with mode:", ModeCurrent)
+			return fmt.Errorf("configuration has conflicting fields")
 		}
-		if res.StatusCode == 403 {
-			w.logr.Println("error: access forbidden", url)
-			return nil, ClientErrorFatal
-		}
-		if res.StatusCode == 400 {
-			w.logr.Println("error: Bad Request", req.URL.String())
-			printResponseBody(w.logr, res.Body)
-			return nil, ClientErrorFatal
+		err = w.parseBatch(args["batch"])
+		if err != nil {
+			return err
 		}
-		w.logr.Println("error: http client error", res.StatusCode, url)
-		printResponseBody(w.logr, res.Body)
-
-		w.logr.Println("Note: if you recently created the OpenWeatherMap api-key, try again in a few minutes")
-		return nil, ClientErrorRetry
 	}
 
-	if RedirectStatus(res.StatusCode) {
-		if res.StatusCode != 304 {
-			w.logr.Println("warning: unhandled http status", res.StatusCode, url)
-		}
-		// data not modified since last response,
-		// means cache is still valid even if expired
-		cachehit, _ := w.cachedResult(lat, lon)
-		if cachehit != nil {
-			w.logr.Println("info: openweather using cached result (data not modified)")
+	w.logr.Println("Initialized!")
+	return nil
+}
 
-			// check for new expires
-			expiresHdr := res.Header.Get("Expires")
-			w.logr.Println("value not changed | new expires header:", expiresHdr)
+// unitSystem holds the units of values returned for each
+// of the 'units' options of the api
+type unitSystem struct {
+	temperature string
+	speed       string
+}
 
-			// reuse existing last-modified time
-			lastModHdr := lastModified.Format(time.RFC1123)
+var unitSystems = map[string]unitSystem{
+	"metric":   {temperature: Celcius, speed: MetersPerSecond},
+	"imperial": {temperature: Farenheight, speed: MilesPerHour},
+	"standard": {temperature: Kelvin, speed: MetersPerSecond},
+}
 
-			w.setCachedResult(lat, lon, expiresHdr, lastModHdr, cachehit)
-			return cachehit, nil
-		}
+// QueryAll returns the current conditions, one record per
+// location of a batch, and in onecall mode also every
+// forecast and alert record
+func (w *OpenWeatherService) QueryAll() ([]integrations.Data, error) {
+	if len(w.batch) > 0 {
+		return w.batchQuery()
 	}
-
-	if SuccessStatus(res.StatusCode) {
-		if res.StatusCode == 203 {
-			w.logr.Println("warning: depreciated service or api:", url)
-			w.logr.Println("  |>> options: update, create pull request, or open an issue")
-			w.logr.Println("  |>> see: https://github.com/jpxor/go-weather-reporter/issues")
-		}
-
-		buf, err := ioutil.ReadAll(res.Body)
+	if w.mode != ModeOneCall {
+		data, err := w.Query()
 		if err != nil {
-			w.logr.Println("error: failed to read response from", url)
 			return nil, err
 		}
+		return []integrations.Data{data}, nil
+	}
+	w.logr.Println("querying OpenWeather One Call")
 
-		result := OpenWeatherResponse{}
-		err = json.Unmarshal(buf, &result)
+	lat, lon, err := w.location()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.oneCallQuery(w.client, lat, lon)
+	if err != nil {
+		w.logr.Println("openweather.oneCallQuery failed")
+		return nil, err
+	}
+	return w.oneCallRecords(resp), nil
+}
+
+func (w *OpenWeatherService) Query() (integrations.Data, error) {
+	if w.mode == ModeOneCall || len(w.batch) > 0 {
+		records, err := w.QueryAll()
 		if err != nil {
-			w.logr.Println("error: failed to parse response from", url)
-			w.logr.Println(err)
-			return nil, err
+			return integrations.Data{}, err
 		}
-
-		// cache result
-		expiresHdr := res.Header.Get("Expires")
-		lastModHdr := res.Header.Get("Last-Modified")
-		w.logr.Println("caching result | expires header:", expiresHdr)
-		w.setCachedResult(lat, lon, expiresHdr, lastModHdr, &result)
-
-		return &result, nil
+		if len(records) == 0 {
+			return integrations.Data{}, fmt.Errorf("openweather response is empty")
+		}
+		return records[0], nil
 	}
+	w.logr.Println("querying OpenWeather")
 
-	return nil, fmt.Errorf("openweather unknown error")
-}
-
-func printResponseBody(logr *log.Logger, body io.ReadCloser) {
-	buf, err := ioutil.ReadAll(body)
+	lat, lon, err := w.location()
+	if err != nil {
+		return integrations.Data{}, err
+	}
+	current, err := w.currentWeatherQuery(w.client, lat, lon)
 	if err != nil {
-		logr.Println("error: failed to read response body")
+		w.logr.Println("openweather.currentWeatherQuery failed")
+		return integrations.Data{}, err
 	}
-	logr.Println(string(buf))
+	if len(current.Weather) == 0 {
+		w.logr.Println("error: response is missing weather conditions")
+		return integrations.Data{}, fmt.Errorf("openweather response is missing weather conditions")
+	}
+	return integrations.Data{
+		Time:   time.Unix(current.Time, 0),
+		Fields: current.fields(unitSystems[w.units]),
+	}, nil
 }
 
-func cacheKey(lat, lon float64) string {
-	// lat and long uses a single decimal point of precision
-	// alt is meters above sea level and uses 20m resolution
-	return fmt.Sprintf("%d-%d", int(lat*10), int(lon*10))
-}
+func (w *OpenWeatherService) currentWeatherQuery(client *http.Client, lat, lon float64) (*OpenWeatherResponse, error) {
+	q := url.Values{}
+	q.Add("lat", fmt.Sprintf("%.4f", lat))
+	q.Add("lon", fmt.Sprintf("%.4f", lon))
+	q.Add("units", w.units)
+	q.Add("lang", w.lang)
 
-func (w *OpenWeatherService) cachedResult(lat, lon float64) (*OpenWeatherResponse, time.Time) {
-	cachehit := w.cache[cacheKey(lat, lon)]
-	if cachehit.Expires.After(time.Now()) {
-		return cachehit.Result, cachehit.LastModified
+	result := OpenWeatherResponse{}
+	err := w.apiGet(client, "/data/2.5/weather", q, &result)
+	if err != nil {
+		return nil, err
 	}
-	return nil, cachehit.LastModified
+	return &result, nil
 }
 
-func (w *OpenWeatherService) setCachedResult(lat, lon float64, expiresHdr, lastModHdr string, result *OpenWeatherResponse) {
-	var cacheEntry CachedResult
-	expires, err := time.Parse(time.RFC1123, expiresHdr)
-	if err == nil {
-		cacheEntry = CachedResult{
-			Expires: expires,
-			Result:  result,
-		}
-	}
-	if cacheEntry.Result == nil {
-		// set our own expires if the above failed
-		// From https://openweathermap.org
-		//    " First, we recommend making API calls no more than once in 10 minutes for
-		//      each location, whether you call it by city name, geographical coordinates
-		//      or by zip code. The update frequency of the OpenWeather model is not
-		//      higher than once in 10 minutes. "
-		cacheEntry = CachedResult{
-			Expires: time.Now().Add(10 * time.Minute),
-			Result:  result,
-		}
+// fields maps every value of the response to a field,
+// the condition code and icon are for dashboard icons
+func (r *OpenWeatherResponse) fields(units unitSystem) map[string]integrations.Field {
+	fields := map[string]integrations.Field{
+		Temperature:         {Value: r.Main.Temperature, Unit: units.temperature},
+		FeelsLike:           {Value: r.Main.FeelsLike, Unit: units.temperature},
+		TemperatureMin:      {Value: r.Main.MinTemperature, Unit: units.temperature},
+		TemperatureMax:      {Value: r.Main.MaxTemperature, Unit: units.temperature},
+		RelHumidity:         {Value: r.Main.RelHumidity, Unit: Percent},
+		Pressure:            {Value: r.Main.Pressure, Unit: HectoPascal},
+		PressureSeaLevel:    {Value: r.Main.SeaLevel, Unit: HectoPascal},
+		PressureGroundLevel: {Value: r.Main.GroundLevel, Unit: HectoPascal},
+		Visibility:          {Value: r.Visibility, Unit: Meters},
+		WindSpeed:           {Value: r.Wind.Speed, Unit: units.speed},
+		WindDirection:       {Value: r.Wind.Direction, Unit: Degrees},
+		WindGust:            {Value: r.Wind.Gust, Unit: units.speed},
+		CloudCover:          {Value: r.Clouds.All, Unit: Percent},
+		Rain1h:              {Value: r.Rain.OneHour, Unit: Millimeters},
+		Rain3h:              {Value: r.Rain.ThreeHours, Unit: Millimeters},
+		Snow1h:              {Value: r.Snow.OneHour, Unit: Millimeters},
+		Snow3h:              {Value: r.Snow.ThreeHours, Unit: Millimeters},
+		Sunrise:             {Value: time.Unix(r.Sys.Sunrise, 0), Unit: Time},
+		Sunset:              {Value: time.Unix(r.Sys.Sunset, 0), Unit: Time},
+		Latitude:            {Value: r.Location.Latitude, Unit: Degrees},
+		Longitude:           {Value: r.Location.Longitude, Unit: Degrees},
+		Timezone:            {Value: r.Timezone, Unit: Seconds},
+		StationName:         {Value: r.Name, Unit: Text},
+		Country:             {Value: r.Sys.Country, Unit: Text},
+		CityID:              {Value: r.ID, Unit: Index},
 	}
-	w.cache[cacheKey(lat, lon)] = cacheEntry
-}
-
-func (w *OpenWeatherService) selfThrottle() {
-	// openweathermap.org free-tier allows 60 calls per minute,
-	// so we self-throttle by enforcing at least 1 second interval
-	// between requests
-	sinceLastReq := time.Now().Sub(w.previousRequest)
-	if sinceLastReq < 1*time.Second {
-		fmt.Println("self-throttled, sleeping for", 1*time.Second-sinceLastReq)
-		time.Sleep(1*time.Second - sinceLastReq)
+	if len(r.Weather) > 0 {
+		fields[Condition] = integrations.Field{Value: r.Weather[0].Main, Unit: Text}
+		fields[Description] = integrations.Field{Value: r.Weather[0].Description, Unit: Text}
+		fields[ConditionCode] = integrations.Field{Value: r.Weather[0].ID, Unit: Index}
+		fields[ConditionIcon] = integrations.Field{Value: r.Weather[0].IconID, Unit: Text}
+		addCondition(fields, r.Weather[0].ID, r.Weather[0].IconID)
 	}
+	return fields
 }
 
 type OpenWeatherResponse struct {
@@ -346,6 +262,8 @@ type OpenWeatherResponse struct {
 		MaxTemperature float32 `json:"temp_max"`
 		Pressure       float32 `json:"pressure"`
 		RelHumidity    float32 `json:"humidity"`
+		SeaLevel       float32 `json:"sea_level"`
+		GroundLevel    float32 `json:"grnd_level"`
 	} `json:"main"`
 	Visibility float32 `json:"visibility"`
 	Wind       struct {
@@ -356,6 +274,14 @@ type OpenWeatherResponse struct {
 	Clouds struct {
 		All float32 `json:"all"`
 	} `json:"clouds"`
+	Rain struct {
+		OneHour    float32 `json:"1h"`
+		ThreeHours float32 `json:"3h"`
+	} `json:"rain"`
+	Snow struct {
+		OneHour    float32 `json:"1h"`
+		ThreeHours float32 `json:"3h"`
+	} `json:"snow"`
 	Time int64 `json:"dt"`
 	Sys  struct {
 		Type    int    `json:"type"`
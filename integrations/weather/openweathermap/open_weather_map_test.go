@@ -0,0 +1,88 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     OpenWeatherMap integration
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package openweathermap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/jpxor/go-weather-reporter/integrations/weather"
+	"github.com/jpxor/go-weather-reporter/pkg/httphelper"
+)
+
+// the cassettes are replayed, so no request reaches openweathermap.org.
+// The apikey is masked in the recording, so any key matches
+func TestQueryReplay(t *testing.T) {
+	httphelper.SetReplayDir("testdata/cassettes")
+	defer httphelper.SetReplayDir("")
+
+	w := &OpenWeatherService{}
+	err := w.Init(map[string]interface{}{
+		"apikey":    "test-apikey",
+		"latitude":  45.4215,
+		"longitude": -75.6972,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := w.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := time.Unix(1704110400, 0); !data.Time.Equal(want) {
+		t.Errorf("time: got %v, want %v", data.Time, want)
+	}
+	for name, want := range map[string]interface{}{
+		Temperature:         float32(12.3),
+		WindGust:            float32(7.2),
+		Rain1h:              float32(0.42),
+		StationName:         "Ottawa",
+		ConditionCode:       500,
+		ConditionIcon:       "10d",
+		NormalizedCondition: ConditionLightRain,
+		Daylight:            Day,
+	} {
+		if got := data.Fields[name].Value; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	if got := data.Fields[Temperature].Unit; got != Celcius {
+		t.Errorf("temperature unit: got %s, want %s", got, Celcius)
+	}
+}
+
+func TestOneCallAlertTags(t *testing.T) {
+	resp := &OneCallResponse{}
+	for _, event := range []string{"Wind warning", "Snowfall warning", "Wind warning"} {
+		resp.Alerts = append(resp.Alerts, oneCallAlert{Event: event, Start: 1704110400})
+	}
+	w := &OpenWeatherService{units: "metric"}
+
+	seen := make(map[string]bool)
+	for _, record := range w.oneCallRecords(resp) {
+		tag := record.Tags[AlertTag]
+		if seen[tag] {
+			t.Errorf("alerts starting at the same time share the tag %q", tag)
+		}
+		seen[tag] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("got %d alert records, want 3", len(seen))
+	}
+}
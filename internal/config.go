@@ -17,10 +17,13 @@
 package internal
 
 import (
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -28,64 +31,225 @@ import (
 
 type ConfigParser struct {
 	logr *log.Logger
+
+	// Recursive enables loading config files from
+	// subdirectories of each config directory
+	Recursive bool
+
+	// tracks every file loaded so far (absolute path -> path
+	// as given) so that the same file is never loaded twice
+	loaded map[string]string
 }
 
 type Opts struct {
-	ConfigDir string
-	Once      bool
+	ConfigDirs    []string
+	ConfigFiles   []string
+	Recursive     bool
+	CacheDir      string
+	HTTPRecordDir string
+	HTTPReplayDir string
+	MetricsAddr   string
+	Once          bool
+	PrintConfig   bool
+	Only          []string
+	Except        []string
+	Labels        []string
 }
 
 type Config []ServiceConfig
 
 type ServiceConfig struct {
 	Name         string
-	ConfPath     string
+	ConfPath     string            `yaml:"-"`
+	Enabled      *bool             `yaml:",omitempty"`
+	Labels       map[string]string `yaml:",omitempty"`
+	Include      []string          `yaml:",omitempty"`
+	Locations    []Location        `yaml:",omitempty"`
 	Source       map[string]interface{}
 	Destinations []map[string]interface{}
 }
 
 func NewConfigParser(logr *log.Logger) *ConfigParser {
-	return &ConfigParser{logr: logr}
+	return &ConfigParser{
+		logr:   logr,
+		loaded: make(map[string]string),
+	}
 }
 
-func (c *ConfigParser) ParseConfigFiles(dir string) (Config, error) {
+// Parse loads every config file found in dirs, followed by each
+// of the files, in that order, then the service configured through
+// environment variables (if any). Files within a directory are loaded
+// in lexical order. It is an error for two services to share a
+// name, or for the same file to be loaded more than once.
+func (c *ConfigParser) Parse(dirs, files []string) (Config, error) {
 	var conf Config
 
-	dirents, err := os.ReadDir(dir)
+	for _, dir := range dirs {
+		dconf, err := c.ParseConfigDir(dir)
+		if err != nil {
+			return conf, err
+		}
+		conf = append(conf, dconf...)
+	}
+	for _, path := range files {
+		fconf, err := c.ParseConfigFile(path)
+		if err != nil {
+			return conf, err
+		}
+		conf = append(conf, fconf...)
+	}
+	econf, err := ParseEnvConfig(os.Environ())
 	if err != nil {
 		return conf, err
 	}
+	conf = append(conf, econf...)
+	return conf, checkDuplicateNames(conf)
+}
+
+// ParseConfigFiles loads every config file in dir
+func (c *ConfigParser) ParseConfigFiles(dir string) (Config, error) {
+	return c.Parse([]string{dir}, nil)
+}
 
-	for _, dirent := range dirents {
-		if !dirent.IsDir() {
-
-			path := filepath.Join(dir, dirent.Name())
-			switch filepath.Ext(dirent.Name()) {
-
-			case ".yaml":
-				c.logr.Println(dirent.Name())
-				content, err := os.ReadFile(path)
-				if err != nil {
-					return conf, err
-				}
-				content = EnvVarSubstitution(content)
-				c, err := ParseYamlConfig(content)
-				if err != nil {
-					return conf, err
-				}
-				for _, service := range c {
-					service.ConfPath = path
-				}
-				conf = append(conf, c...)
-
-			default:
-				c.logr.Println("info: skipping file", dirent.Name())
+// ParseConfigDir loads the config files in dir, and in its
+// subdirectories when the parser is recursive
+func (c *ConfigParser) ParseConfigDir(dir string) (Config, error) {
+	var paths []string
+
+	err := filepath.WalkDir(dir, func(path string, dirent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirent.IsDir() {
+			if path != dir && !c.Recursive {
+				return filepath.SkipDir
 			}
+			return nil
 		}
+		if filepath.Ext(path) != ".yaml" {
+			c.logr.Println("info: skipping file", path)
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var conf Config
+	for _, path := range paths {
+		fconf, err := c.ParseConfigFile(path)
+		if err != nil {
+			return conf, err
+		}
+		conf = append(conf, fconf...)
 	}
 	return conf, nil
 }
 
+// ParseConfigFile loads a single config file, along with any
+// files it includes
+func (c *ConfigParser) ParseConfigFile(path string) (Config, error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if prev, ok := c.loaded[abspath]; ok {
+		return nil, fmt.Errorf("config file loaded twice: %s (already loaded as %s)", path, prev)
+	}
+	c.loaded[abspath] = path
+
+	c.logr.Println(path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content = EnvVarSubstitution(content)
+	fconf, err := ParseYamlConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var conf Config
+	for _, service := range fconf {
+		if len(service.Include) == 0 {
+			service.ConfPath = path
+			expanded, err := expandLocations(service)
+			if err != nil {
+				return nil, err
+			}
+			conf = append(conf, expanded...)
+			continue
+		}
+		if service.Name != "" || service.Source != nil || service.Destinations != nil || service.Locations != nil || service.Enabled != nil || service.Labels != nil {
+			return nil, fmt.Errorf("%s: include entries must not define a service", path)
+		}
+		iconf, err := c.parseIncludes(path, service.Include)
+		if err != nil {
+			return nil, err
+		}
+		conf = append(conf, iconf...)
+	}
+	return conf, nil
+}
+
+// parseIncludes loads the files matching each glob pattern,
+// relative paths are relative to the including file
+func (c *ConfigParser) parseIncludes(path string, patterns []string) (Config, error) {
+	var conf Config
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad include pattern: %w", path, err)
+		}
+		if len(matches) == 0 {
+			if !hasGlobMeta(pattern) {
+				return nil, fmt.Errorf("%s: included file not found: %s", path, pattern)
+			}
+			c.logr.Println("warning: include pattern matched no files:", pattern, "in", path)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			var iconf Config
+			if info.IsDir() {
+				iconf, err = c.ParseConfigDir(match)
+			} else {
+				iconf, err = c.ParseConfigFile(match)
+			}
+			if err != nil {
+				return nil, err
+			}
+			conf = append(conf, iconf...)
+		}
+	}
+	return conf, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func checkDuplicateNames(conf Config) error {
+	seen := make(map[string]string)
+	for _, service := range conf {
+		if prev, ok := seen[service.Name]; ok {
+			return fmt.Errorf("duplicate service name %q in %s (first defined in %s)", service.Name, service.ConfPath, prev)
+		}
+		seen[service.Name] = service.ConfPath
+	}
+	return nil
+}
+
 func ParseYamlConfig(src []byte) (Config, error) {
 	var conf Config
 	err := yaml.UnmarshalStrict([]byte(src), &conf)
@@ -0,0 +1,207 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
+	"gopkg.in/yaml.v2"
+)
+
+// A single service can be configured entirely from environment
+// variables, for example:
+//
+//	WR_SERVICE_NAME=current-weather-home
+//	WR_SOURCE_NAME=openweathermap
+//	WR_SOURCE_POLL_INTERVAL=10m
+//	WR_SOURCE_LATITUDE=45.45
+//	WR_DEST_0_NAME=influxdb2
+//	WR_DEST_0_FIELDS=temperature,relative_humidity
+//	WR_DEST_0_TAGS={location: home}
+//
+// Keys are lower-cased. Values of known string keys, ie. apikey or
+// token, are kept as is, coordinates are numbers, and flow style
+// values ({...} or [...]) are parsed as yaml. Other values are an
+// int, a float, true or false when they parse as one, or a string.
+const (
+	envPrefix       = "WR_"
+	envServiceName  = "WR_SERVICE_NAME"
+	envSourceName   = "WR_SOURCE_NAME"
+	envSourcePrefix = "WR_SOURCE_"
+	envDestPrefix   = "WR_DEST_"
+
+	// used for both the default service name and its ConfPath
+	envConfPath = "environment"
+)
+
+// HasEnvConfig reports whether a service is configured
+// through environment variables
+func HasEnvConfig(environ []string) bool {
+	for _, env := range environ {
+		if strings.HasPrefix(env, envSourceName+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEnvConfig builds a service config from WR_ environment
+// variables, it returns an empty config if WR_SOURCE_NAME is unset
+func ParseEnvConfig(environ []string) (Config, error) {
+	if !HasEnvConfig(environ) {
+		return nil, nil
+	}
+	service := ServiceConfig{
+		Name:     envConfPath,
+		ConfPath: envConfPath,
+		Source:   make(map[string]interface{}),
+	}
+	dests := make(map[int]map[string]interface{})
+
+	for _, env := range environ {
+		key, val, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+		switch {
+		case key == envServiceName:
+			service.Name = val
+
+		case strings.HasPrefix(key, envSourcePrefix):
+			name := strings.ToLower(strings.TrimPrefix(key, envSourcePrefix))
+			value, err := parseEnvValue(name, val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			service.Source[name] = value
+
+		case strings.HasPrefix(key, envDestPrefix):
+			index, name, ok := strings.Cut(strings.TrimPrefix(key, envDestPrefix), "_")
+			i, err := strconv.Atoi(index)
+			if !ok || err != nil || name == "" {
+				return nil, fmt.Errorf("%s: expected %s<n>_<key>", key, envDestPrefix)
+			}
+			name = strings.ToLower(name)
+			value, err := parseEnvValue(name, val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if dests[i] == nil {
+				dests[i] = make(map[string]interface{})
+			}
+			dests[i][name] = value
+		}
+	}
+
+	// destinations are ordered by index, gaps are allowed
+	indices := make([]int, 0, len(dests))
+	for i := range dests {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	for _, i := range indices {
+		service.Destinations = append(service.Destinations, dests[i])
+	}
+	return Config{service}, nil
+}
+
+// envStringKeys always hold strings, a numeric apikey
+// or a 'yes' token must not change type
+var envStringKeys = map[string]bool{
+	"name":          true,
+	"poll_interval": true,
+	"apikey":        true,
+	"token":         true,
+	"contact":       true,
+	"user_agent":    true,
+	"city":          true,
+	"zip":           true,
+	"host":          true,
+	"base_url":      true,
+	"org":           true,
+	"bucket":        true,
+	"measurement":   true,
+	"language":      true,
+	"units":         true,
+	"mode":          true,
+	"variant":       true,
+	"station":       true,
+	"proxy":         true,
+	"ca_file":       true,
+	"client_cert":   true,
+	"client_key":    true,
+}
+
+// envFloatKeys are coordinates, which sources expect as
+// float64 even when given as a whole number
+var envFloatKeys = map[string]bool{
+	"latitude":  true,
+	"longitude": true,
+	"altitude":  true,
+}
+
+func parseEnvValue(key, val string) (interface{}, error) {
+	trimmed := strings.TrimSpace(val)
+
+	switch {
+	case envStringKeys[key] || redact.IsSecretKey(key):
+		return val, nil
+
+	case envFloatKeys[key]:
+		f, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, got %q", val)
+		}
+		return f, nil
+
+	// fields may be given as a plain comma separated list
+	case key == "fields" && !strings.HasPrefix(trimmed, "["):
+		var fields []interface{}
+		for _, field := range strings.Split(val, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+		return fields, nil
+
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		var value interface{}
+		err := yaml.Unmarshal([]byte(val), &value)
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+
+	if i, err := strconv.Atoi(trimmed); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+		return f, nil
+	}
+	switch trimmed {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return val, nil
+}
@@ -0,0 +1,57 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEnvValue(t *testing.T) {
+	tests := []struct {
+		key, val string
+		want     interface{}
+	}{
+		{"apikey", "0123456789", "0123456789"},
+		{"token", "yes", "yes"},
+		{"password", "1234", "1234"},
+		{"zip", "01234,US", "01234,US"},
+		{"poll_interval", "10m", "10m"},
+		{"latitude", "45", 45.0},
+		{"longitude", "-75.69", -75.69},
+		{"city_id", "6094817", 6094817},
+		{"forecast", "true", true},
+		{"forecast", "yes", "yes"},
+		{"fields", "temperature, relative_humidity", []interface{}{"temperature", "relative_humidity"}},
+		{"fields", "[temperature]", []interface{}{"temperature"}},
+		{"tags", "{location: home}", map[interface{}]interface{}{"location": "home"}},
+	}
+	for _, test := range tests {
+		got, err := parseEnvValue(test.key, test.val)
+		if err != nil {
+			t.Errorf("%s=%s: %v", test.key, test.val, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s=%s: got %#v, want %#v", test.key, test.val, got, test.want)
+		}
+	}
+
+	if _, err := parseEnvValue("latitude", "north"); err == nil {
+		t.Error("latitude=north: expected an error")
+	}
+}
@@ -0,0 +1,144 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Location is one site of a multi-location service template
+type Location struct {
+	Name      string
+	Latitude  *float64
+	Longitude *float64
+	Altitude  *float64
+	Tags      map[string]string
+}
+
+var locationPlaceholder = regexp.MustCompile(`\${location\.(\w+)}`)
+
+// expandLocations turns a service template with a list of locations
+// into one service per location. The source coordinates are set from
+// each location, and ${location.name}-style placeholders are replaced
+// in both source and destination settings. Extra location tags are
+// added to the tags of every destination.
+func expandLocations(service ServiceConfig) (Config, error) {
+	if len(service.Locations) == 0 {
+		return Config{service}, nil
+	}
+	var conf Config
+
+	for i, loc := range service.Locations {
+		if loc.Name == "" {
+			return nil, fmt.Errorf("%s: service %s: location %d is missing a name", service.ConfPath, service.Name, i)
+		}
+		if loc.Latitude == nil || loc.Longitude == nil {
+			return nil, fmt.Errorf("%s: service %s: location %s is missing latitude or longitude", service.ConfPath, service.Name, loc.Name)
+		}
+		vars := loc.placeholders()
+		var missing []string
+
+		expanded := ServiceConfig{
+			Name:     service.Name + "-" + loc.Name,
+			ConfPath: service.ConfPath,
+			Enabled:  service.Enabled,
+			Labels:   service.Labels,
+			Source:   substituteMap(service.Source, vars, &missing),
+		}
+		expanded.Source["latitude"] = *loc.Latitude
+		expanded.Source["longitude"] = *loc.Longitude
+		if loc.Altitude != nil {
+			expanded.Source["altitude"] = *loc.Altitude
+		}
+
+		for _, dest := range service.Destinations {
+			dest = substituteMap(dest, vars, &missing)
+			if len(loc.Tags) > 0 {
+				tags, _ := dest["tags"].(map[interface{}]interface{})
+				if tags == nil {
+					tags = make(map[interface{}]interface{})
+				}
+				for k, v := range loc.Tags {
+					tags[k] = v
+				}
+				dest["tags"] = tags
+			}
+			expanded.Destinations = append(expanded.Destinations, dest)
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%s: service %s: location %s has no value for %v", service.ConfPath, service.Name, loc.Name, missing)
+		}
+		conf = append(conf, expanded)
+	}
+	return conf, nil
+}
+
+func (loc Location) placeholders() map[string]string {
+	vars := make(map[string]string)
+	for k, v := range loc.Tags {
+		vars[k] = v
+	}
+	vars["name"] = loc.Name
+	vars["latitude"] = strconv.FormatFloat(*loc.Latitude, 'f', -1, 64)
+	vars["longitude"] = strconv.FormatFloat(*loc.Longitude, 'f', -1, 64)
+	if loc.Altitude != nil {
+		vars["altitude"] = strconv.FormatFloat(*loc.Altitude, 'f', -1, 64)
+	}
+	return vars
+}
+
+// substituteMap deep copies a config map, replacing location
+// placeholders in every string value. Placeholders without a
+// value are left as is and appended to missing.
+func substituteMap(in map[string]interface{}, vars map[string]string, missing *[]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		out[k] = substituteValue(v, vars, missing)
+	}
+	return out
+}
+
+func substituteValue(val interface{}, vars map[string]string, missing *[]string) interface{} {
+	switch v := val.(type) {
+	case string:
+		return locationPlaceholder.ReplaceAllStringFunc(v, func(match string) string {
+			key := locationPlaceholder.FindStringSubmatch(match)[1]
+			if sub, ok := vars[key]; ok {
+				return sub
+			}
+			*missing = append(*missing, match)
+			return match
+		})
+	case map[interface{}]interface{}:
+		out := make(map[interface{}]interface{}, len(v))
+		for k, e := range v {
+			out[k] = substituteValue(e, vars, missing)
+		}
+		return out
+	case map[string]interface{}:
+		return substituteMap(v, vars, missing)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = substituteValue(e, vars, missing)
+		}
+		return out
+	}
+	return val
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/jpxor/go-weather-reporter/integrations"
 	"github.com/jpxor/go-weather-reporter/integrations/database/influxdb"
+	"github.com/jpxor/go-weather-reporter/integrations/weather/metno"
 	"github.com/jpxor/go-weather-reporter/integrations/weather/openweathermap"
 )
 
@@ -73,6 +74,16 @@ func getSourceIntegration(name string) integrations.SourceInterface {
 	switch name {
 	case openweathermap.Name:
 		return &openweathermap.OpenWeatherService{}
+	case openweathermap.AirPollutionName:
+		return &openweathermap.AirPollutionService{}
+	case metno.Name:
+		return &metno.MetNoService{}
+	case metno.NowcastName:
+		return &metno.NowcastService{}
+	case metno.SunriseName:
+		return &metno.SunriseService{}
+	case metno.AirQualityName:
+		return &metno.AirQualityService{}
 	}
 	return nil
 }
@@ -100,18 +111,27 @@ func StartService(config ServiceStart) {
 	nextrun := time.Now()
 	for {
 		if nextrun.Before(time.Now()) {
-			data, err := config.source.Query()
+			records, err := queryAll(config.source)
 			if err != nil {
 				config.logr.Println(err)
 			} else {
 				for _, dest := range config.dests {
-					err := dest.Report(data)
-					if err != nil {
-						config.logr.Println(err)
+					for _, data := range records {
+						err := dest.Report(data)
+						if err != nil {
+							config.logr.Println(err)
+						}
 					}
 				}
 			}
 			nextrun = nextrun.Add(config.interval)
+
+			if throttled, ok := config.source.(integrations.ThrottledSourceInterface); ok {
+				if next := throttled.NextQuery(); next.After(nextrun) {
+					config.logr.Println("source data expires at", next.Format(time.RFC3339), "delaying the next query")
+					nextrun = next
+				}
+			}
 		}
 		if config.once {
 			break
@@ -120,6 +140,17 @@ func StartService(config ServiceStart) {
 	}
 }
 
+func queryAll(source integrations.SourceInterface) ([]integrations.Data, error) {
+	if multi, ok := source.(integrations.MultiSourceInterface); ok {
+		return multi.QueryAll()
+	}
+	data, err := source.Query()
+	if err != nil {
+		return nil, err
+	}
+	return []integrations.Data{data}, nil
+}
+
 func Run(config Config, opts Opts, logr *log.Logger) {
 
 	var wg sync.WaitGroup
@@ -0,0 +1,117 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"io"
+
+	"github.com/jpxor/go-weather-reporter/integrations"
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
+	"gopkg.in/yaml.v2"
+)
+
+// RegisterSecrets registers the value of every secret config
+// key with the redact package, so they are masked in logs
+func RegisterSecrets(config Config) {
+	for _, service := range config {
+		walkSecrets(service.Source, sourceSecretKeys(service.Source), func(val string) string {
+			redact.Register(val)
+			return val
+		})
+		for _, dest := range service.Destinations {
+			walkSecrets(dest, destinationSecretKeys(dest), func(val string) string {
+				redact.Register(val)
+				return val
+			})
+		}
+	}
+}
+
+// PrintConfig writes the effective config as yaml, with secrets masked
+func PrintConfig(w io.Writer, config Config) error {
+	masked := make(Config, 0, len(config))
+	mask := func(string) string {
+		return redact.Mask
+	}
+	for _, service := range config {
+		service.Source = copyMap(service.Source)
+		walkSecrets(service.Source, sourceSecretKeys(service.Source), mask)
+
+		dests := make([]map[string]interface{}, 0, len(service.Destinations))
+		for _, dest := range service.Destinations {
+			dest = copyMap(dest)
+			walkSecrets(dest, destinationSecretKeys(dest), mask)
+			dests = append(dests, dest)
+		}
+		service.Destinations = dests
+		masked = append(masked, service)
+	}
+	out, err := yaml.Marshal(masked)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(redact.String(string(out))))
+	return err
+}
+
+func sourceSecretKeys(config map[string]interface{}) map[string]bool {
+	name, _ := config["name"].(string)
+	return secretKeySet(getSourceIntegration(name))
+}
+
+func destinationSecretKeys(config map[string]interface{}) map[string]bool {
+	name, _ := config["name"].(string)
+	return secretKeySet(getDestinationIntegration(name))
+}
+
+func secretKeySet(integration interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	if i, ok := integration.(integrations.SecretsInterface); ok {
+		for _, key := range i.SecretKeys() {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// walkSecrets replaces the value of every secret key in config
+// (and in nested maps) with the result of fn
+func walkSecrets(config map[string]interface{}, keys map[string]bool, fn func(string) string) {
+	for k, v := range config {
+		if keys[k] || redact.IsSecretKey(k) {
+			if str, ok := v.(string); ok {
+				config[k] = fn(str)
+			}
+			continue
+		}
+		if nested, ok := v.(map[interface{}]interface{}); ok {
+			for nk, nv := range nested {
+				key, _ := nk.(string)
+				str, ok := nv.(string)
+				if ok && (keys[key] || redact.IsSecretKey(key)) {
+					nested[nk] = fn(str)
+				}
+			}
+		}
+	}
+}
+
+// copyMap deep copies a config map, substituting
+// without any placeholder values is a plain copy
+func copyMap(in map[string]interface{}) map[string]interface{} {
+	return substituteMap(in, nil, new([]string))
+}
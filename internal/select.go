@@ -0,0 +1,100 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// SelectServices filters the config down to the services that should
+// run: disabled services are dropped, then services not matching the
+// -only, -except and -labels options
+func SelectServices(config Config, opts Opts, logr *log.Logger) (Config, error) {
+	labels, err := parseLabels(opts.Labels)
+	if err != nil {
+		return nil, err
+	}
+	only := make(map[string]bool)
+	for _, name := range opts.Only {
+		only[name] = false
+	}
+	except := make(map[string]bool)
+	for _, name := range opts.Except {
+		except[name] = false
+	}
+
+	var selected Config
+	for _, service := range config {
+		_, inOnly := only[service.Name]
+		if inOnly {
+			only[service.Name] = true
+		}
+		_, inExcept := except[service.Name]
+		if inExcept {
+			except[service.Name] = true
+		}
+
+		switch {
+		case service.Enabled != nil && !*service.Enabled:
+			logr.Println("info: service disabled:", service.Name)
+		case len(only) > 0 && !inOnly:
+			logr.Println("info: service not selected (-only):", service.Name)
+		case inExcept:
+			logr.Println("info: service not selected (-except):", service.Name)
+		case !service.matchLabels(labels):
+			logr.Println("info: service not selected (-labels):", service.Name)
+		default:
+			selected = append(selected, service)
+		}
+	}
+
+	// catch typos, rather than silently running nothing
+	for name, found := range only {
+		if !found {
+			return nil, fmt.Errorf("-only: no service named %q", name)
+		}
+	}
+	for name, found := range except {
+		if !found {
+			return nil, fmt.Errorf("-except: no service named %q", name)
+		}
+	}
+	return selected, nil
+}
+
+func (s ServiceConfig) matchLabels(labels map[string]string) bool {
+	for k, v := range labels {
+		if s.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func parseLabels(in []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, label := range in {
+		k, v, ok := strings.Cut(label, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("-labels: expected key=value, got %q", label)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
@@ -0,0 +1,369 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatusHeader is set on every response returned by the
+// CachingTransport, to one of the CacheHit, CacheRevalidated
+// or CacheMiss values
+const CacheStatusHeader = "X-Cache-Status"
+
+const (
+	CacheHit         = "HIT"
+	CacheRevalidated = "REVALIDATED"
+	CacheMiss        = "MISS"
+)
+
+type CacheEntry struct {
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	Expires      time.Time
+	ETag         string
+	LastModified string
+}
+
+func (e *CacheEntry) fresh() bool {
+	return time.Now().Before(e.Expires)
+}
+
+// staleTTL is how long an expired entry with an ETag or
+// Last-Modified is kept to revalidate it, entries without
+// them are of no use once expired
+const staleTTL = 24 * time.Hour
+
+func (e *CacheEntry) evictable(now time.Time) bool {
+	if e.ETag == "" && e.LastModified == "" {
+		return !now.Before(e.Expires)
+	}
+	return !now.Before(e.Expires.Add(staleTTL))
+}
+
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+}
+
+// DefaultCache is the store used by NewCachingTransport,
+// replace it with a DiskStore to persist across restarts
+var DefaultCache CacheStore = NewMemoryStore()
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*CacheEntry)}
+}
+
+func (s *MemoryStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	return entry, ok
+}
+
+func (s *MemoryStore) Set(key string, entry *CacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry
+}
+
+func (s *MemoryStore) delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// DiskStoreMaxEntries is the number of files a DiskStore keeps,
+// a sweep removes the entries that expire first beyond it
+var DiskStoreMaxEntries = 1000
+
+// sweepEvery is the number of writes between sweeps of a DiskStore
+const sweepEvery = 100
+
+// DiskStore keeps one file per entry in dir, with an in-memory
+// copy so each entry is read from disk at most once. Expired
+// entries are removed when read, and by a sweep of dir when
+// it is opened and every sweepEvery writes.
+type DiskStore struct {
+	dir    string
+	memory *MemoryStore
+
+	mu     sync.Mutex
+	writes int
+}
+
+func NewDiskStore(dir string) (*DiskStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	s := &DiskStore{dir: dir, memory: NewMemoryStore()}
+	err = s.sweep()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sweep removes the evictable entries of dir, then the entries
+// that expire first while there are more than DiskStoreMaxEntries
+func (s *DiskStore) sweep() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	type file struct {
+		path    string
+		expires time.Time
+	}
+	var kept []file
+	now := time.Now()
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(s.dir, f.Name())
+		entry := &CacheEntry{}
+		buf, err := os.ReadFile(path)
+		if err != nil || json.Unmarshal(buf, entry) != nil || entry.evictable(now) {
+			os.Remove(path)
+			continue
+		}
+		kept = append(kept, file{path, entry.Expires})
+	}
+	if len(kept) > DiskStoreMaxEntries {
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].expires.Before(kept[j].expires)
+		})
+		for _, f := range kept[:len(kept)-DiskStoreMaxEntries] {
+			os.Remove(f.path)
+		}
+	}
+
+	// the memory copy is rebuilt from the remaining files
+	s.memory = NewMemoryStore()
+	return nil
+}
+
+func (s *DiskStore) path(key string) string {
+	// keys are urls, which may contain api keys
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *DiskStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.memory.Get(key)
+	if !ok {
+		buf, err := os.ReadFile(s.path(key))
+		if err != nil {
+			return nil, false
+		}
+		entry = &CacheEntry{}
+		if json.Unmarshal(buf, entry) != nil {
+			os.Remove(s.path(key))
+			return nil, false
+		}
+	}
+	if entry.evictable(time.Now()) {
+		s.memory.delete(key)
+		os.Remove(s.path(key))
+		return nil, false
+	}
+	s.memory.Set(key, entry)
+	return entry, true
+}
+
+func (s *DiskStore) Set(key string, entry *CacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writes++
+	if s.writes%sweepEvery == 0 {
+		s.sweep()
+	}
+	s.memory.Set(key, entry)
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// write then rename, so a crash never leaves a partial entry
+	path := s.path(key)
+	tmp := path + ".tmp"
+	if os.WriteFile(tmp, buf, 0600) == nil {
+		os.Rename(tmp, path)
+	}
+}
+
+// CachingTransport is an http.RoundTripper that caches successful
+// GET responses and revalidates them with conditional requests
+// (If-None-Match, If-Modified-Since) once they expire. Freshness comes
+// from Cache-Control max-age, then Expires, then DefaultTTL.
+type CachingTransport struct {
+	Transport  http.RoundTripper
+	Store      CacheStore
+	DefaultTTL time.Duration
+}
+
+func NewCachingTransport(transport http.RoundTripper, defaultTTL time.Duration) *CachingTransport {
+	return &CachingTransport{
+		Transport:  transport,
+		Store:      DefaultCache,
+		DefaultTTL: defaultTTL,
+	}
+}
+
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.Transport.RoundTrip(req)
+	}
+	key := req.URL.String()
+
+	entry, cached := t.Store.Get(key)
+	if cached && entry.fresh() {
+		return entry.response(req, CacheHit), nil
+	}
+
+	if cached {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	res, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && cached {
+		res.Body.Close()
+
+		// data not modified, so the cached entry is valid
+		// again with the freshness of the new response
+		updated := *entry
+		updated.Header = entry.Header.Clone()
+		for _, hdr := range []string{"Cache-Control", "Expires", "Date", "ETag", "Last-Modified"} {
+			if val := res.Header.Get(hdr); val != "" {
+				updated.Header.Set(hdr, val)
+			}
+		}
+		updated.ETag = updated.Header.Get("ETag")
+		updated.LastModified = updated.Header.Get("Last-Modified")
+		updated.Expires, _ = t.expires(updated.Header)
+		t.Store.Set(key, &updated)
+		return updated.response(req, CacheRevalidated), nil
+	}
+
+	if !SuccessStatus(res.StatusCode) {
+		return res, nil
+	}
+
+	expires, store := t.expires(res.Header)
+	if !store {
+		res.Header.Set(CacheStatusHeader, CacheMiss)
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry = &CacheEntry{
+		StatusCode:   res.StatusCode,
+		Header:       res.Header.Clone(),
+		Body:         body,
+		Expires:      expires,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	t.Store.Set(key, entry)
+	return entry.response(req, CacheMiss), nil
+}
+
+// expires returns when a response goes stale, and whether it may be stored
+func (t *CachingTransport) expires(header http.Header) (time.Time, bool) {
+	now := time.Now()
+
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return now, false
+		case directive == "no-cache":
+			// may be stored, but must always be revalidated
+			return now, true
+		case strings.HasPrefix(directive, "max-age="):
+			maxAge, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil {
+				age, _ := strconv.Atoi(header.Get("Age"))
+				return now.Add(time.Duration(maxAge-age) * time.Second), true
+			}
+		}
+	}
+
+	if expiresHdr := header.Get("Expires"); expiresHdr != "" {
+		expires, err := http.ParseTime(expiresHdr)
+		if err == nil {
+			return expires, true
+		}
+		// an invalid Expires means already expired
+		return now, true
+	}
+	return now.Add(t.DefaultTTL), true
+}
+
+func (e *CacheEntry) response(req *http.Request, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set(CacheStatusHeader, status)
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,240 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCachingTransport(t *testing.T) {
+	expired := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name string
+		// headers of the full response
+		header map[string]string
+		// headers of a 304 answer to a revalidation
+		revalidated map[string]string
+		// cache status of each request, and the requests that reach the server
+		want     []string
+		wantHits int
+	}{
+		{
+			name:     "max-age",
+			header:   map[string]string{"Cache-Control": "max-age=60"},
+			want:     []string{CacheMiss, CacheHit, CacheHit},
+			wantHits: 1,
+		},
+		{
+			name:     "max-age wins over expires",
+			header:   map[string]string{"Cache-Control": "max-age=0", "Expires": future, "ETag": `"v1"`},
+			want:     []string{CacheMiss, CacheRevalidated},
+			wantHits: 2,
+		},
+		{
+			name:     "expires",
+			header:   map[string]string{"Expires": future},
+			want:     []string{CacheMiss, CacheHit},
+			wantHits: 1,
+		},
+		{
+			name:     "no-store",
+			header:   map[string]string{"Cache-Control": "no-store", "ETag": `"v1"`},
+			want:     []string{CacheMiss, CacheMiss},
+			wantHits: 2,
+		},
+		{
+			name:     "no-cache revalidates every time",
+			header:   map[string]string{"Cache-Control": "no-cache", "ETag": `"v1"`},
+			want:     []string{CacheMiss, CacheRevalidated, CacheRevalidated},
+			wantHits: 3,
+		},
+		{
+			name:        "304 refreshes expires",
+			header:      map[string]string{"Expires": expired, "ETag": `"v1"`},
+			revalidated: map[string]string{"Expires": future},
+			want:        []string{CacheMiss, CacheRevalidated, CacheHit},
+			wantHits:    2,
+		},
+		{
+			name:        "304 by last-modified",
+			header:      map[string]string{"Expires": expired, "Last-Modified": "Mon, 01 Jan 2024 12:00:00 GMT"},
+			revalidated: map[string]string{"Cache-Control": "max-age=60"},
+			want:        []string{CacheMiss, CacheRevalidated, CacheHit},
+			wantHits:    2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hits := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				etag, modified := test.header["ETag"], test.header["Last-Modified"]
+				if (etag != "" && r.Header.Get("If-None-Match") == etag) ||
+					(modified != "" && r.Header.Get("If-Modified-Since") == modified) {
+					for k, v := range test.revalidated {
+						w.Header().Set(k, v)
+					}
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				for k, v := range test.header {
+					w.Header().Set(k, v)
+				}
+				w.Write([]byte("body"))
+			}))
+			defer srv.Close()
+
+			client := &http.Client{Transport: &CachingTransport{
+				Transport:  http.DefaultTransport,
+				Store:      NewMemoryStore(),
+				DefaultTTL: time.Minute,
+			}}
+			var got []string
+			for range test.want {
+				res, err := client.Get(srv.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := ioutil.ReadAll(res.Body)
+				res.Body.Close()
+				if res.StatusCode != 200 || string(body) != "body" {
+					t.Fatalf("got %d %q, want the cached 200 response", res.StatusCode, body)
+				}
+				got = append(got, res.Header.Get(CacheStatusHeader))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("cache status: got %v, want %v", got, test.want)
+			}
+			if hits != test.wantHits {
+				t.Errorf("server hits: got %d, want %d", hits, test.wantHits)
+			}
+		})
+	}
+}
+
+func TestDiskStorePersists(t *testing.T) {
+	dir := t.TempDir()
+	entry := &CacheEntry{
+		StatusCode:   200,
+		Header:       http.Header{"Etag": {`"v1"`}},
+		Body:         []byte("body"),
+		Expires:      time.Now().Add(time.Hour).Round(time.Second),
+		ETag:         `"v1"`,
+		LastModified: "Mon, 01 Jan 2024 12:00:00 GMT",
+	}
+	store, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("https://example.com/data?appid=secret", entry)
+
+	// a new store, as after a restart
+	store, err = NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := store.Get("https://example.com/data?appid=secret")
+	if !ok {
+		t.Fatal("entry not found after restart")
+	}
+	if !got.Expires.Equal(entry.Expires) {
+		t.Errorf("expires: got %v, want %v", got.Expires, entry.Expires)
+	}
+	got.Expires = entry.Expires
+	if !reflect.DeepEqual(got, entry) {
+		t.Errorf("got %+v, want %+v", got, entry)
+	}
+	if _, ok := store.Get("https://example.com/other"); ok {
+		t.Error("found an entry that was never stored")
+	}
+}
+
+func TestDiskStoreEvicts(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.Set("expired", &CacheEntry{StatusCode: 200, Expires: now.Add(-time.Minute)})
+	store.Set("stale", &CacheEntry{StatusCode: 200, Expires: now.Add(-time.Minute), ETag: `"v1"`})
+	store.Set("old", &CacheEntry{StatusCode: 200, Expires: now.Add(-2 * staleTTL), ETag: `"v1"`})
+	store.Set("fresh", &CacheEntry{StatusCode: 200, Expires: now.Add(time.Hour)})
+
+	// an expired entry is removed when read, unless it can still be revalidated
+	if _, ok := store.Get("expired"); ok {
+		t.Error("expired: got an entry")
+	}
+	if _, err := os.Stat(store.path("expired")); !os.IsNotExist(err) {
+		t.Error("expired: file not removed on read")
+	}
+	if _, ok := store.Get("stale"); !ok {
+		t.Error("stale: entry with an ETag removed before it could be revalidated")
+	}
+
+	// opening the store sweeps the entries that can't be used anymore
+	store, err = NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(store.path("old")); !os.IsNotExist(err) {
+		t.Error("old: file not swept")
+	}
+	for _, key := range []string{"stale", "fresh"} {
+		if _, ok := store.Get(key); !ok {
+			t.Errorf("%s: entry swept", key)
+		}
+	}
+}
+
+func TestDiskStoreMaxEntries(t *testing.T) {
+	defer func(max int) { DiskStoreMaxEntries = max }(DiskStoreMaxEntries)
+	DiskStoreMaxEntries = 2
+
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, key := range []string{"first", "second", "third"} {
+		store.Set(key, &CacheEntry{StatusCode: 200, Expires: now.Add(time.Duration(i+1) * time.Hour)})
+	}
+
+	// the entry that expires first goes
+	store, err = NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get("first"); ok {
+		t.Error("first: entry kept beyond the limit")
+	}
+	for _, key := range []string{"second", "third"} {
+		if _, ok := store.Get(key); !ok {
+			t.Errorf("%s: entry removed", key)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ClientConfig holds the http client settings shared by
+// every http based integration:
+//
+//	proxy: http://proxy.local:3128   # or "none", default from HTTP(S)_PROXY/NO_PROXY
+//	ca_file: /etc/ssl/internal-ca.pem
+//	client_cert: /etc/ssl/client.pem
+//	client_key: /etc/ssl/client.key
+//	insecure_skip_verify: false
+type ClientConfig struct {
+	Timeout            time.Duration
+	Proxy              string
+	CAFile             string
+	ClientCert         string
+	ClientKey          string
+	InsecureSkipVerify bool
+}
+
+// ParseClientConfig reads the client settings from an integration config
+func ParseClientConfig(config map[string]interface{}, timeout time.Duration) (ClientConfig, error) {
+	c := ClientConfig{Timeout: timeout}
+
+	for key, dst := range map[string]*string{
+		"proxy":       &c.Proxy,
+		"ca_file":     &c.CAFile,
+		"client_cert": &c.ClientCert,
+		"client_key":  &c.ClientKey,
+	} {
+		if val, ok := config[key]; ok {
+			str, ok := val.(string)
+			if !ok {
+				return c, fmt.Errorf("%s: expected a string", key)
+			}
+			*dst = str
+		}
+	}
+	if val, ok := config["insecure_skip_verify"]; ok {
+		skip, ok := val.(bool)
+		if !ok {
+			return c, fmt.Errorf("insecure_skip_verify: expected true or false")
+		}
+		c.InsecureSkipVerify = skip
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return c, fmt.Errorf("client_cert and client_key must be set together")
+	}
+	return c, nil
+}
+
+// Build creates a new http client from the config
+func (c ClientConfig) Build() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		// trust the system roots as well as the custom CA
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file: no certificates found in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("client_cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch c.Proxy {
+	case "":
+	case "none":
+		proxy = nil
+	default:
+		proxyUrl, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout: c.Timeout,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: c.Timeout,
+	}
+	return &http.Client{
+		Timeout:   c.Timeout,
+		Transport: withRecordReplay(transport),
+	}, nil
+}
+
+// NewClient creates an http client from the client
+// settings of an integration config
+func NewClient(config map[string]interface{}, timeout time.Duration) (*http.Client, error) {
+	c, err := ParseClientConfig(config, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return c.Build()
+}
@@ -0,0 +1,153 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
+)
+
+// how much of an error response body is kept
+const bodySnippetLen = 512
+
+// StatusError is returned for unsuccessful responses. It wraps one of
+// the sentinel errors (ServerErrorRetry, ClientErrorFatal, ...) so
+// callers can still use errors.Is.
+type StatusError struct {
+	StatusCode int
+	URL        string
+	Body       string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%v: http status %d from %s", e.Err, e.StatusCode, e.URL)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %v)", e.RetryAfter)
+	}
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// CheckResponse returns nil for successful responses, and otherwise
+// a *StatusError classified as fatal or worth retrying. It reads the
+// start of the body of unsuccessful responses.
+func CheckResponse(res *http.Response) error {
+	if SuccessStatus(res.StatusCode) {
+		return nil
+	}
+	err := &StatusError{
+		StatusCode: res.StatusCode,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		Err:        classifyStatus(res.StatusCode),
+	}
+	if res.Request != nil {
+		err.URL = redact.URL(res.Request.URL)
+	}
+	buf, _ := io.ReadAll(io.LimitReader(res.Body, bodySnippetLen))
+	err.Body = redact.String(strings.TrimSpace(string(buf)))
+	return err
+}
+
+func classifyStatus(code int) error {
+	switch {
+	case ServerErrorStatus(code):
+		return ServerErrorRetry
+	case code == http.StatusTooManyRequests:
+		return ClientErrorRetry
+	case code == http.StatusBadRequest || code == http.StatusForbidden:
+		return ClientErrorFatal
+	case ClientErrorStatus(code):
+		return ClientErrorRetry
+	}
+	// redirects are followed by the client, so any
+	// that get here are not something we can handle
+	return UnexpectedStatus
+}
+
+// parseRetryAfter accepts both forms of the header, a number
+// of seconds or an http date
+func parseRetryAfter(val string) time.Duration {
+	if val == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(val); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(val); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// DeprecationWarning describes a response from a deprecated api,
+// signalled by status 203 (Non-Authoritative Information, used by
+// MET Norway) or by the Deprecation and Sunset headers
+type DeprecationWarning struct {
+	URL         string
+	StatusCode  int
+	Deprecation string
+	Sunset      string
+	Link        string
+}
+
+func (d *DeprecationWarning) String() string {
+	msg := fmt.Sprintf("deprecated api: url=%s status=%d", d.URL, d.StatusCode)
+	if d.Deprecation != "" {
+		msg += fmt.Sprintf(" deprecation=%q", d.Deprecation)
+	}
+	if d.Sunset != "" {
+		msg += fmt.Sprintf(" sunset=%q", d.Sunset)
+	}
+	if d.Link != "" {
+		msg += fmt.Sprintf(" link=%q", d.Link)
+	}
+	return msg
+}
+
+// CheckDeprecation returns a *DeprecationWarning when the response
+// signals that the api is deprecated, and otherwise nil
+func CheckDeprecation(res *http.Response) *DeprecationWarning {
+	d := &DeprecationWarning{
+		StatusCode:  res.StatusCode,
+		Deprecation: res.Header.Get("Deprecation"),
+		Sunset:      res.Header.Get("Sunset"),
+		Link:        res.Header.Get("Link"),
+	}
+	if res.StatusCode != http.StatusNonAuthoritativeInfo && d.Deprecation == "" && d.Sunset == "" {
+		return nil
+	}
+	if res.Request != nil {
+		d.URL = redact.URL(res.Request.URL)
+	}
+	return d
+}
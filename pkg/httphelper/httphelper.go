@@ -18,11 +18,8 @@ package httphelper
 
 import (
 	"fmt"
-	"net"
-	"net/http"
 	"net/url"
-	"os"
-	"time"
+	"strings"
 )
 
 // HTTP Client helpers
@@ -32,6 +29,8 @@ var ServerErrorRetry = fmt.Errorf("server error (EAGAIN)")
 var ClientErrorFatal = fmt.Errorf("client error (FATAL)")
 var ClientErrorRetry = fmt.Errorf("client error (EAGAIN)")
 
+var UnexpectedStatus = fmt.Errorf("unexpected http status (FATAL)")
+
 func ServerErrorStatus(code int) bool {
 	return code >= 500
 }
@@ -48,29 +47,24 @@ func SuccessStatus(code int) bool {
 	return code >= 200 && code < 300
 }
 
-//********************************************************************//
-//** The following function is separately licensed                  **//
-//** Copied From:                                                   **//
-//**     https://github.com/jackdoe/go-metno/blob/master/metno.go   **//
-//********************************************************************//
-func SimpleClient(timeout time.Duration) *http.Client {
-	var netTransport = &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: timeout,
-		}).Dial,
-		DisableCompression:  false,
-		TLSHandshakeTimeout: timeout,
+// BaseURL reads the optional base_url of an integration config,
+// so a provider can be pointed at a proxy, mock or paid endpoint
+func BaseURL(config map[string]interface{}, defaultURL string) (*url.URL, error) {
+	base, ok := config["base_url"].(string)
+	if !ok {
+		base = defaultURL
 	}
-	proxyString := os.Getenv("HTTPS_PROXY")
-	if proxyString != "" {
-		proxyUrl, err := url.Parse(proxyString)
-		if err == nil {
-			netTransport.Proxy = http.ProxyURL(proxyUrl)
-		}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("base_url: %w", err)
 	}
-	var netClient = &http.Client{
-		Timeout:   timeout,
-		Transport: netTransport,
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base_url: expected an absolute url, got %q", base)
 	}
-	return netClient
+	return u, nil
+}
+
+// Endpoint joins an api path onto a base url
+func Endpoint(base *url.URL, path string) string {
+	return strings.TrimSuffix(base.String(), "/") + path
 }
@@ -0,0 +1,233 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
+)
+
+// Middleware wraps a RoundTripper to add behaviour to every request
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps transport with each middleware, the
+// first middleware is the outermost
+func Chain(transport http.RoundTripper, middleware ...Middleware) http.RoundTripper {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	return transport
+}
+
+// Logging logs each request with its status and latency
+func Logging(logr *log.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				logr.Println("http:", req.Method, redact.URL(req.URL), "failed after", elapsed, redact.Error(err))
+				return res, err
+			}
+			logr.Println("http:", req.Method, redact.URL(req.URL), res.StatusCode, elapsed)
+			return res, err
+		})
+	}
+}
+
+// Tracing starts a new W3C trace for each request that
+// doesn't already carry a traceparent header
+func Tracing() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("traceparent") != "" {
+				return next.RoundTrip(req)
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", randomHex(16), randomHex(8)))
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+type hostMetrics struct {
+	requests     map[int]uint64
+	errors       uint64
+	latencySum   time.Duration
+	latencyCount uint64
+	cache        map[string]uint64
+}
+
+// ClientMetrics counts requests, errors, latency and cache
+// status per host
+type ClientMetrics struct {
+	mu    sync.Mutex
+	hosts map[string]*hostMetrics
+}
+
+// DefaultMetrics collects the metrics of every source client
+var DefaultMetrics = NewClientMetrics()
+
+func NewClientMetrics() *ClientMetrics {
+	return &ClientMetrics{hosts: make(map[string]*hostMetrics)}
+}
+
+func (m *ClientMetrics) host(host string) *hostMetrics {
+	h, ok := m.hosts[host]
+	if !ok {
+		h = &hostMetrics{
+			requests: make(map[int]uint64),
+			cache:    make(map[string]uint64),
+		}
+		m.hosts[host] = h
+	}
+	return h
+}
+
+// Metrics records the status, errors and latency of each request
+// in m, it belongs below the cache and rate limiter so only requests
+// sent to the provider are counted
+func Metrics(m *ClientMetrics) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			elapsed := time.Since(start)
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			h := m.host(req.URL.Host)
+			h.latencySum += elapsed
+			h.latencyCount++
+			if err != nil {
+				h.errors++
+				return res, err
+			}
+			h.requests[res.StatusCode]++
+			return res, err
+		})
+	}
+}
+
+// CacheMetrics records the cache status of each response in m,
+// it belongs above the cache
+func CacheMetrics(m *ClientMetrics) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				return res, err
+			}
+			if status := res.Header.Get(CacheStatusHeader); status != "" {
+				m.mu.Lock()
+				m.host(req.URL.Host).cache[status]++
+				m.mu.Unlock()
+			}
+			return res, err
+		})
+	}
+}
+
+// WritePrometheus writes the metrics in the prometheus text format
+func (m *ClientMetrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hosts := make([]string, 0, len(m.hosts))
+	for host := range m.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	fmt.Fprintln(w, "# TYPE weather_reporter_http_requests_total counter")
+	for _, host := range hosts {
+		h := m.hosts[host]
+		codes := make([]int, 0, len(h.requests))
+		for code := range h.requests {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "weather_reporter_http_requests_total{host=%q,code=\"%d\"} %d\n", host, code, h.requests[code])
+		}
+	}
+	fmt.Fprintln(w, "# TYPE weather_reporter_http_errors_total counter")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "weather_reporter_http_errors_total{host=%q} %d\n", host, m.hosts[host].errors)
+	}
+	fmt.Fprintln(w, "# TYPE weather_reporter_http_request_duration_seconds summary")
+	for _, host := range hosts {
+		h := m.hosts[host]
+		fmt.Fprintf(w, "weather_reporter_http_request_duration_seconds_sum{host=%q} %f\n", host, h.latencySum.Seconds())
+		fmt.Fprintf(w, "weather_reporter_http_request_duration_seconds_count{host=%q} %d\n", host, h.latencyCount)
+	}
+	fmt.Fprintln(w, "# TYPE weather_reporter_http_cache_total counter")
+	for _, host := range hosts {
+		h := m.hosts[host]
+		for _, status := range []string{CacheHit, CacheRevalidated, CacheMiss} {
+			fmt.Fprintf(w, "weather_reporter_http_cache_total{host=%q,status=%q} %d\n", host, status, h.cache[status])
+		}
+	}
+}
+
+// MetricsHandler serves DefaultMetrics for scraping
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		DefaultMetrics.WritePrometheus(w)
+	})
+}
+
+// NewSourceClient builds the standard stack for http based sources: the
+// client settings from config, a cache, the shared rate limiter, and
+// the logging, metrics and tracing middleware
+func NewSourceClient(config map[string]interface{}, timeout time.Duration, limiter *RateLimiter, defaultTTL time.Duration, logr *log.Logger) (*http.Client, error) {
+	client, err := NewClient(config, timeout)
+	if err != nil {
+		return nil, err
+	}
+	// only requests that miss the cache are rate limited, logged,
+	// traced and counted, the cache status is counted above it
+	network := Chain(client.Transport, Logging(logr), Metrics(DefaultMetrics), Tracing())
+	client.Transport = Chain(
+		NewCachingTransport(NewRateLimitedTransport(network, limiter), defaultTTL),
+		CacheMetrics(DefaultMetrics),
+	)
+	return client, nil
+}
@@ -0,0 +1,61 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSourceClientCountsSentRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("traceparent") == "" {
+			t.Error("request sent without a traceparent")
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	DefaultCache = NewMemoryStore()
+	client, err := NewSourceClient(map[string]interface{}{}, 0, NewRateLimiter(PerSecond(100)), 0, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	u, _ := url.Parse(server.URL)
+	DefaultMetrics.mu.Lock()
+	defer DefaultMetrics.mu.Unlock()
+	h := DefaultMetrics.host(u.Host)
+	if h.requests[200] != 1 || h.latencyCount != 1 {
+		t.Errorf("got %d requests and %d latencies, want only the one sent", h.requests[200], h.latencyCount)
+	}
+	if h.cache[CacheMiss] != 1 || h.cache[CacheHit] != 2 {
+		t.Errorf("got cache status %v, want 1 miss and 2 hits", h.cache)
+	}
+}
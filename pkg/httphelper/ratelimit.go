@@ -0,0 +1,256 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Rate limits requests to Requests per Period. Burst is the number
+// of requests that may be sent back to back, it defaults to 1 which
+// spaces requests evenly over the period. Configured rates set it to
+// Requests, so they are a budget that may be spent at any time.
+type Rate struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func PerSecond(n int) Rate {
+	return Rate{Requests: n, Period: time.Second}
+}
+
+func PerMinute(n int) Rate {
+	return Rate{Requests: n, Period: time.Minute}
+}
+
+func PerDay(n int) Rate {
+	return Rate{Requests: n, Period: 24 * time.Hour}
+}
+
+// ParseRates reads a rate_limit config section:
+//
+//	rate_limit:
+//	  per_second: 20
+//	  per_minute: 60
+//	  per_day: 1000
+//
+// Each is a budget for its period, ie. per_day: 1000 allows a batch
+// of requests at once rather than one every 86 seconds. A nil section
+// returns no rates.
+func ParseRates(config interface{}) ([]Rate, error) {
+	if config == nil {
+		return nil, nil
+	}
+	section, ok := config.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rate_limit: expected a map")
+	}
+	var rates []Rate
+	for k, v := range section {
+		n, ok := v.(int)
+		if !ok || n <= 0 {
+			return nil, fmt.Errorf("rate_limit: %v must be a positive integer", k)
+		}
+		var rate Rate
+		switch k {
+		case "per_second":
+			rate = PerSecond(n)
+		case "per_minute":
+			rate = PerMinute(n)
+		case "per_day":
+			rate = PerDay(n)
+		default:
+			return nil, fmt.Errorf("rate_limit: unknown key %v", k)
+		}
+		rate.Burst = n
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// SourceRates reads the rate_limit section of a source config, and
+// always adds the provider's default rates, so a configured rate can
+// only lower them. A configured rate for the same period as a default
+// is clamped to it.
+func SourceRates(config interface{}, defaults ...Rate) ([]Rate, error) {
+	configured, err := ParseRates(config)
+	if err != nil {
+		return nil, err
+	}
+	rates := append([]Rate{}, defaults...)
+	for _, rate := range configured {
+		for _, def := range defaults {
+			if rate.Period == def.Period && rate.Requests > def.Requests {
+				rate.Requests = def.Requests
+			}
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+type bucket struct {
+	Rate
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate Rate) *bucket {
+	if rate.Burst < 1 {
+		rate.Burst = 1
+	}
+	if rate.Burst > rate.Requests {
+		rate.Burst = rate.Requests
+	}
+	return &bucket{
+		Rate:   rate,
+		tokens: float64(rate.Burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens earned since the last refill,
+// and returns how long until the next token is available
+func (b *bucket) refill(now time.Time) time.Duration {
+	perToken := b.Period / time.Duration(b.Requests)
+	b.tokens += float64(now.Sub(b.last)) / float64(perToken)
+	if b.tokens > float64(b.Burst) {
+		b.tokens = float64(b.Burst)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+// RateLimiter is a token-bucket limiter that enforces every one
+// of its rates, ie. both a per-minute and a per-day limit
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets []*bucket
+}
+
+func NewRateLimiter(rates ...Rate) *RateLimiter {
+	l := &RateLimiter{}
+	l.restrict(rates)
+	return l
+}
+
+// Wait blocks until a request may be sent, and
+// returns how long it waited
+func (l *RateLimiter) Wait() time.Duration {
+	var waited time.Duration
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		for _, b := range l.buckets {
+			if d := b.refill(now); d > wait {
+				wait = d
+			}
+		}
+		if wait == 0 {
+			for _, b := range l.buckets {
+				b.tokens--
+			}
+			l.mu.Unlock()
+			return waited
+		}
+		l.mu.Unlock()
+		time.Sleep(wait)
+		waited += wait
+	}
+}
+
+// restrict adds rates to the limiter. When one with the same period
+// exists the minimum of both the requests and the burst is kept, so
+// the result doesn't depend on the order services are initialized in
+func (l *RateLimiter) restrict(rates []Rate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+next:
+	for _, rate := range rates {
+		if rate.Requests <= 0 || rate.Period <= 0 {
+			continue
+		}
+		add := newBucket(rate)
+		for _, b := range l.buckets {
+			if b.Period != add.Period {
+				continue
+			}
+			if add.Requests < b.Requests {
+				b.Requests = add.Requests
+			}
+			if add.Burst < b.Burst {
+				b.Burst = add.Burst
+			}
+			if b.Burst > b.Requests {
+				b.Burst = b.Requests
+			}
+			if b.tokens > float64(b.Burst) {
+				b.tokens = float64(b.Burst)
+			}
+			continue next
+		}
+		l.buckets = append(l.buckets, add)
+	}
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*RateLimiter)
+)
+
+// SharedRateLimiter returns the process-wide limiter for a host and
+// credential (ie. api key, may be empty), so that every service using
+// the same account shares one budget. Rates are added to the limiter,
+// the strictest rate for each period wins.
+func SharedRateLimiter(host, credential string, rates ...Rate) *RateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	key := host + "|" + credential
+	l, ok := limiters[key]
+	if !ok {
+		l = &RateLimiter{}
+		limiters[key] = l
+	}
+	l.restrict(rates)
+	return l
+}
+
+// RateLimitedTransport waits on its limiter before each request,
+// place it below a CachingTransport so cache hits are not throttled
+type RateLimitedTransport struct {
+	Transport http.RoundTripper
+	Limiter   *RateLimiter
+}
+
+func NewRateLimitedTransport(transport http.RoundTripper, limiter *RateLimiter) *RateLimitedTransport {
+	return &RateLimitedTransport{Transport: transport, Limiter: limiter}
+}
+
+func (t *RateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Limiter.Wait()
+	return t.Transport.RoundTrip(req)
+}
@@ -0,0 +1,113 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRatesBudget(t *testing.T) {
+	rates, err := ParseRates(map[interface{}]interface{}{"per_day": 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewRateLimiter(rates...)
+
+	// a configured limit is a budget, not an even spacing
+	for i := 0; i < 20; i++ {
+		if waited := l.Wait(); waited > 0 {
+			t.Fatalf("request %d waited %v within the daily budget", i, waited)
+		}
+	}
+}
+
+func TestDefaultRateSpacing(t *testing.T) {
+	b := newBucket(PerMinute(60))
+	now := time.Now()
+	if wait := b.refill(now); wait != 0 {
+		t.Fatalf("first request: got wait %v, want 0", wait)
+	}
+	b.tokens--
+
+	// the built-in defaults space requests evenly
+	wait := b.refill(now)
+	if wait < 900*time.Millisecond || wait > time.Second {
+		t.Errorf("second request: got wait %v, want about 1s", wait)
+	}
+}
+
+func TestParseRatesInvalid(t *testing.T) {
+	for _, config := range []interface{}{
+		"60",
+		map[interface{}]interface{}{"per_hour": 10},
+		map[interface{}]interface{}{"per_minute": 0},
+		map[interface{}]interface{}{"per_minute": "ten"},
+	} {
+		if _, err := ParseRates(config); err == nil {
+			t.Errorf("ParseRates(%v): expected an error", config)
+		}
+	}
+}
+
+func TestSourceRatesKeepsDefaults(t *testing.T) {
+	rates, err := SourceRates(map[interface{}]interface{}{"per_day": 1000}, PerMinute(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewRateLimiter(rates...)
+	if len(l.buckets) != 2 {
+		t.Fatalf("got %d buckets, want the default and the daily budget", len(l.buckets))
+	}
+	l.Wait()
+	if wait := l.buckets[0].refill(time.Now()); wait == 0 {
+		t.Errorf("per_day config dropped the per-minute default")
+	}
+
+	rates, err = SourceRates(map[interface{}]interface{}{"per_minute": 600}, PerMinute(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rate := range rates {
+		if rate.Requests > 60 {
+			t.Errorf("configured rate %+v exceeds the default", rate)
+		}
+	}
+}
+
+func TestRestrictOrder(t *testing.T) {
+	configured, err := SourceRates(map[interface{}]interface{}{"per_minute": 30}, PerMinute(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := []Rate{PerMinute(60)}
+
+	a := NewRateLimiter(defaults...)
+	a.restrict(configured)
+	b := NewRateLimiter(configured...)
+	b.restrict(defaults)
+
+	if len(a.buckets) != 1 || len(b.buckets) != 1 {
+		t.Fatalf("got %d and %d buckets, want 1", len(a.buckets), len(b.buckets))
+	}
+	for _, l := range []*RateLimiter{a, b} {
+		got := l.buckets[0]
+		if got.Requests != 30 || got.Burst != 1 {
+			t.Errorf("got %d requests burst %d, want 30 burst 1", got.Requests, got.Burst)
+		}
+	}
+}
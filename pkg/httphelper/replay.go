@@ -0,0 +1,163 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
+)
+
+// record or replay directories for every client created by
+// ClientConfig.Build, at most one of them is set
+var (
+	recordDir string
+	replayDir string
+)
+
+// SetRecordDir records the responses of every GET request
+// to cassette files in dir
+func SetRecordDir(dir string) {
+	recordDir, replayDir = dir, ""
+}
+
+// SetReplayDir serves every GET request from the cassette
+// files in dir, without any network access
+func SetReplayDir(dir string) {
+	recordDir, replayDir = "", dir
+}
+
+// Cassette is a recorded response, stored as json. The url and
+// body have secrets masked, and the request is identified by its
+// masked url so that replay works with any api key.
+type Cassette struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// headers that may carry credentials or session state
+var unrecordedHeaders = []string{"Set-Cookie", "Authorization", "Www-Authenticate"}
+
+func cassettePath(dir string, req *http.Request) string {
+	id := req.Method + " " + redact.URL(req.URL)
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(dir, req.URL.Host+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// withRecordReplay wraps the transport of a new client
+func withRecordReplay(transport http.RoundTripper) http.RoundTripper {
+	switch {
+	case replayDir != "":
+		return &ReplayTransport{Dir: replayDir, Transport: transport}
+	case recordDir != "":
+		return &RecordingTransport{Dir: recordDir, Transport: transport}
+	}
+	return transport
+}
+
+// RecordingTransport saves a cassette for each GET response,
+// other requests are passed through unrecorded. A 304 answers
+// a revalidation by the cache, it is not recorded so it doesn't
+// replace the cassette of the full response
+type RecordingTransport struct {
+	Dir       string
+	Transport http.RoundTripper
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.Transport.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || res.StatusCode == http.StatusNotModified {
+		return res, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := res.Header.Clone()
+	for _, hdr := range unrecordedHeaders {
+		header.Del(hdr)
+	}
+	// masking secrets may change the body length
+	header.Del("Content-Length")
+	cassette := Cassette{
+		Method:     req.Method,
+		URL:        redact.URL(req.URL),
+		StatusCode: res.StatusCode,
+		Header:     header,
+		Body:       redact.String(string(body)),
+	}
+	buf, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(t.Dir, 0700)
+	if err == nil {
+		err = os.WriteFile(cassettePath(t.Dir, req), buf, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+	return res, nil
+}
+
+// ReplayTransport answers GET requests from recorded cassettes,
+// other requests are passed through to Transport
+type ReplayTransport struct {
+	Dir       string
+	Transport http.RoundTripper
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.Transport.RoundTrip(req)
+	}
+	buf, err := os.ReadFile(cassettePath(t.Dir, req))
+	if err != nil {
+		return nil, fmt.Errorf("no recorded response for GET %s: %w", redact.URL(req.URL), err)
+	}
+	cassette := Cassette{}
+	err = json.Unmarshal(buf, &cassette)
+	if err != nil {
+		return nil, fmt.Errorf("bad cassette for GET %s: %w", redact.URL(req.URL), err)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(cassette.StatusCode) + " " + http.StatusText(cassette.StatusCode),
+		StatusCode:    cassette.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cassette.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(cassette.Body))),
+		ContentLength: int64(len(cassette.Body)),
+		Request:       req,
+	}, nil
+}
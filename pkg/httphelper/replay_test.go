@@ -0,0 +1,115 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpxor/go-weather-reporter/pkg/redact"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	redact.Register("replay-test-secret")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=abc")
+		fmt.Fprintf(w, `{"temp": 21.5, "echo": "replay-test-secret"}`)
+	}))
+	defer srv.Close()
+	url := srv.URL + "/data?appid=replay-test-secret"
+
+	recorder := &http.Client{Transport: &RecordingTransport{Dir: dir, Transport: http.DefaultTransport}}
+	status, body := get(t, recorder, url)
+	if status != 200 || !strings.Contains(body, "replay-test-secret") {
+		t.Fatalf("recording changed the live response: %d %s", status, body)
+	}
+	srv.Close()
+
+	// replay works with a different api key
+	player := &http.Client{Transport: &ReplayTransport{Dir: dir, Transport: http.DefaultTransport}}
+	status, body = get(t, player, strings.Replace(url, "replay-test-secret", "other-key", 1))
+	if status != 200 {
+		t.Fatalf("replay status: got %d, want 200", status)
+	}
+	if want := `{"temp": 21.5, "echo": "` + redact.Mask + `"}`; body != want {
+		t.Errorf("replay body: got %s, want %s", body, want)
+	}
+
+	_, err := player.Get(srv.URL + "/unrecorded")
+	if err == nil {
+		t.Error("replay of an unrecorded request: expected an error")
+	}
+}
+
+func TestRecordSkipsRevalidation(t *testing.T) {
+	dir := t.TempDir()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=0")
+		fmt.Fprint(w, `{"temp": 21.5}`)
+	}))
+	defer srv.Close()
+
+	// the cache revalidates on the second poll, and gets a 304
+	recorder := &http.Client{Transport: &CachingTransport{
+		Transport: &RecordingTransport{Dir: dir, Transport: http.DefaultTransport},
+		Store:     NewMemoryStore(),
+	}}
+	for i := 0; i < 2; i++ {
+		status, body := get(t, recorder, srv.URL)
+		if status != 200 || body != `{"temp": 21.5}` {
+			t.Fatalf("poll %d: got %d %s", i, status, body)
+		}
+	}
+	srv.Close()
+
+	player := &http.Client{Transport: &CachingTransport{
+		Transport:  &ReplayTransport{Dir: dir, Transport: http.DefaultTransport},
+		Store:      NewMemoryStore(),
+		DefaultTTL: time.Minute,
+	}}
+	status, body := get(t, player, srv.URL)
+	if status != 200 || body != `{"temp": 21.5}` {
+		t.Errorf("replay after revalidation: got %d %s, want the full response", status, body)
+	}
+}
@@ -0,0 +1,150 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ValueCache keeps values that are not http responses, ie. resolved
+// locations, until they expire. Expired values are evicted when read,
+// and swept from memory on each Set and from dir when it is opened.
+type ValueCache struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[string]valueEntry
+}
+
+type valueEntry struct {
+	Value   json.RawMessage
+	Expires time.Time
+}
+
+// DefaultValues is the value cache of the sources, replace
+// it with one from NewValueCache(dir) to persist across restarts
+var DefaultValues, _ = NewValueCache("")
+
+// NewValueCache keeps values in memory, and in one file per
+// value in dir when it is not empty
+func NewValueCache(dir string) (*ValueCache, error) {
+	c := &ValueCache{dir: dir, entries: make(map[string]valueEntry)}
+	if dir == "" {
+		return c, nil
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		var entry valueEntry
+		buf, err := os.ReadFile(path)
+		if err != nil || json.Unmarshal(buf, &entry) != nil || !now.Before(entry.Expires) {
+			os.Remove(path)
+		}
+	}
+	return c, nil
+}
+
+func (c *ValueCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get decodes the value of key into value, it
+// returns false when there is none or it expired
+func (c *ValueCache) Get(key string, value interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok && c.dir != "" {
+		buf, err := os.ReadFile(c.path(key))
+		ok = err == nil && json.Unmarshal(buf, &entry) == nil
+	}
+	if !ok {
+		return false
+	}
+	if !time.Now().Before(entry.Expires) {
+		c.remove(key)
+		return false
+	}
+	if json.Unmarshal(entry.Value, value) != nil {
+		c.remove(key)
+		return false
+	}
+	c.entries[key] = entry
+	return true
+}
+
+// Set keeps value, encoded as json, for key until expires
+func (c *ValueCache) Set(key string, value interface{}, expires time.Time) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	entry := valueEntry{Value: buf, Expires: expires}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if !now.Before(e.Expires) {
+			c.remove(k)
+		}
+	}
+	c.entries[key] = entry
+
+	if c.dir == "" {
+		return nil
+	}
+	buf, err = json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// write then rename, so a crash never leaves a partial value
+	path := c.path(key)
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (c *ValueCache) remove(key string) {
+	delete(c.entries, key)
+	if c.dir != "" {
+		os.Remove(c.path(key))
+	}
+}
@@ -0,0 +1,70 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httphelper
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestValueCacheExpires(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewValueCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("fresh", 1.5, time.Now().Add(time.Hour))
+	c.Set("expired", 2.5, time.Now().Add(-time.Second))
+
+	var got float64
+	if !c.Get("fresh", &got) || got != 1.5 {
+		t.Errorf("fresh: got %v, want 1.5", got)
+	}
+	if c.Get("expired", &got) {
+		t.Error("expired: got a value")
+	}
+	if _, err := os.Stat(c.path("expired")); !os.IsNotExist(err) {
+		t.Error("expired: file not evicted on read")
+	}
+	if _, ok := c.entries["expired"]; ok {
+		t.Error("expired: entry not evicted on read")
+	}
+}
+
+func TestValueCachePersists(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewValueCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("fresh", "oslo", time.Now().Add(time.Hour))
+	c.Set("expired", "bergen", time.Now().Add(-time.Second))
+
+	// a new cache in the same dir sweeps the expired value
+	c, err = NewValueCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.path("expired")); !os.IsNotExist(err) {
+		t.Error("expired: file not swept when opened")
+	}
+	var got string
+	if !c.Get("fresh", &got) || got != "oslo" {
+		t.Errorf("fresh: got %q, want oslo", got)
+	}
+}
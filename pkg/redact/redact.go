@@ -0,0 +1,126 @@
+//     go-weather-reporter: pull from weather service, push to database
+//     Copyright (C) 2022 Josh Simonot
+//
+//     This program is free software: you can redistribute it and/or modify
+//     it under the terms of the GNU General Public License as published by
+//     the Free Software Foundation, either version 3 of the License, or
+//     (at your option) any later version.
+//
+//     This program is distributed in the hope that it will be useful,
+//     but WITHOUT ANY WARRANTY; without even the implied warranty of
+//     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//     GNU General Public License for more details.
+//
+//     You should have received a copy of the GNU General Public License
+//     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package redact keeps secrets (api keys, tokens) out of logs and output.
+// Secret values are registered once at startup, after which they are
+// masked wherever they appear in strings passed through this package.
+package redact
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const Mask = "*****"
+
+// config keys that always hold secrets, whether or not
+// the integration declares them
+var secretKeys = map[string]bool{
+	"apikey":   true,
+	"api_key":  true,
+	"appid":    true,
+	"token":    true,
+	"password": true,
+	"pass":     true,
+	"secret":   true,
+}
+
+// url query parameters that always hold secrets
+var secretParams = regexp.MustCompile(`(?i)([?&](?:appid|apikey|api_key|token|access_token|key)=)[^&\s"']*`)
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// Register adds a secret value to be masked
+func Register(secret string) {
+	// very short values would mask unrelated text
+	if len(secret) < 4 {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+	// mask longest first, in case one secret contains another
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+}
+
+// IsSecretKey reports whether a config key is
+// conventionally used to hold a secret
+func IsSecretKey(key string) bool {
+	return secretKeys[strings.ToLower(key)]
+}
+
+// String masks every registered secret, and the value
+// of secret query parameters in any urls
+func String(s string) string {
+	mu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	mu.RUnlock()
+	return secretParams.ReplaceAllString(s, "${1}"+Mask)
+}
+
+// URL returns the url as a string with secrets masked
+func URL(u *url.URL) string {
+	return String(u.String())
+}
+
+// Error masks secrets in the url of errors returned by
+// http.Client, other errors are returned unchanged
+func Error(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return &url.Error{
+			Op:  uerr.Op,
+			URL: String(uerr.URL),
+			Err: uerr.Err,
+		}
+	}
+	return err
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// Writer wraps w so that everything written to it is masked,
+// it is meant for log output where each write is one line
+func Writer(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.w, String(string(p)))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}